@@ -1,6 +1,6 @@
 module github.com/lafrinte/nops
 
-go 1.21.2
+go 1.22
 
 require (
 	github.com/bytedance/gopkg v0.0.0-20230728082804-614d0af6619b
@@ -8,6 +8,7 @@ require (
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/go-lumberjack/lumberjack v2.0.0+incompatible
 	github.com/gorhill/cronexpr v0.0.0-20180427100037-88b0669f7d75
+	github.com/klauspost/compress v1.18.0
 	github.com/rs/xid v1.5.0
 	github.com/rs/zerolog v1.31.0
 	github.com/shirou/gopsutil v3.21.11+incompatible
@@ -17,6 +18,7 @@ require (
 	github.com/yihleego/trie v0.0.0-20220914121334-78377532f78e
 	github.com/zeromq/goczmq v4.1.0+incompatible
 	go.uber.org/automaxprocs v1.5.3
+	golang.org/x/sys v0.14.0
 	google.golang.org/protobuf v1.31.0
 )
 
@@ -45,7 +47,6 @@ require (
 	github.com/yusufpapurcu/wmi v1.2.3 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d // indirect
-	golang.org/x/sys v0.14.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
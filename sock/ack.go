@@ -0,0 +1,370 @@
+package sock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/xid"
+	"github.com/zeromq/goczmq"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultAckTimeout = time.Second * 5
+	DefaultAckWindow  = 1000
+)
+
+// ErrAckTimeout is the error of msg not acked after RetryAttempts redeliveries
+var ErrAckTimeout = errors.New("ack timeout")
+
+/*
+WithAck makes PUSH socket keep every msg sent until a consumer confirms its Envelope ID on the ack link, Envelope
+is enabled with it. endpoint is bound by a SUB socket receiving acks of this producer, consumers created by
+WithAckConnect publish acks to it.
+
+	msg not acked in timeout is redelivered, and goes to dead letter after RetryAttempts redeliveries. msg failed
+	to send is not retried but waits for redelivery. Publisher stops reading 'in' channel while window msg are in
+	flight. zero value uses the default.
+
+	push := sock.New(sock.WithType("PUSH"), sock.WithAck("tcp://*:5556", 0, 0), ...)
+	pull := sock.New(sock.WithType("PULL"), sock.WithAckConnect("tcp://127.0.0.1:5556"), ...)
+	msg := <-pull.GetOutChannel()
+	_ = pull.Ack(msg)
+*/
+func WithAck(endpoint string, timeout time.Duration, window int) Option {
+	return func(s *Sock) {
+		if timeout <= 0 {
+			timeout = DefaultAckTimeout
+		}
+
+		if window <= 0 {
+			window = DefaultAckWindow
+		}
+
+		s.envelope = true
+		s.acks.endpoint = endpoint
+		s.acks.timeout = timeout
+		s.acks.window = window
+	}
+}
+
+// WithAckConnect makes PULL socket publish acks by Ack to the ack endpoints of producers set by WithAck, Envelope
+// is enabled with it
+func WithAckConnect(endpoints ...string) Option {
+	return func(s *Sock) {
+		s.envelope = true
+		s.acks.peers = append(s.acks.peers, endpoints...)
+	}
+}
+
+// inflight is a msg sent and waiting for ack
+type inflight struct {
+	msg      []byte
+	deadline time.Time
+	attempts uint8
+}
+
+// acker keeps msg in flight on producer and holds the ack link on both sides
+type acker struct {
+	endpoint string
+	timeout  time.Duration
+	window   int
+	peers    []string
+
+	// SUB socket receiving acks on producer, PUB socket sending acks on consumer
+	link   *Sock
+	cancel context.CancelFunc
+	once   sync.Once
+
+	mu      sync.Mutex
+	pending map[xid.ID]*inflight
+	timer   *time.Timer
+
+	acked       atomic.Uint64
+	redelivered atomic.Uint64
+}
+
+func newAcker() *acker {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+
+	return &acker{pending: make(map[xid.ID]*inflight), timer: t}
+}
+
+// tracking reports whether msg sent is kept until acked
+func (a *acker) tracking() bool {
+	return a.endpoint != ""
+}
+
+// initAck creates the ack link, it is called after all options
+func (s *Sock) initAck() {
+	if !s.acks.tracking() && len(s.acks.peers) == 0 {
+		return
+	}
+
+	// ack link lives until socket is released, so the acks in flight are not lost on exit
+	ctx, cancel := context.WithCancel(context.Background())
+	s.acks.cancel = cancel
+
+	if s.acks.tracking() {
+		if s.Type != goczmq.Push {
+			panic(fmt.Errorf("ack only enables by 'type': Push"))
+		}
+
+		s.acks.link = New(
+			WithCtx(ctx),
+			WithType("SUB"),
+			WithBind(s.acks.endpoint),
+			WithSubscribe(s.producerID),
+			WithMaxBufferSize(s.acks.window),
+		)
+
+		return
+	}
+
+	if s.Type != goczmq.Pull {
+		panic(fmt.Errorf("ack connect only enables by 'type': Pull"))
+	}
+
+	s.acks.link = New(
+		WithCtx(ctx),
+		WithType("PUB"),
+		WithConnect(s.acks.peers...),
+		WithMultipart(),
+	)
+}
+
+// start runs the loop of ack link once
+func (a *acker) start(ctx context.Context) {
+	if a.link == nil {
+		return
+	}
+
+	a.once.Do(func() {
+		Pool.CtxGo(ctx, a.link.Run)
+	})
+}
+
+// close stops the ack link
+func (a *acker) close() {
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+// track keeps msg sent until it is acked
+func (s *Sock) track(msg []byte) {
+	if !s.acks.tracking() {
+		return
+	}
+
+	e, err := s.unwrap(msg)
+	if err != nil {
+		return
+	}
+
+	a := s.acks
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending[e.ID] = &inflight{msg: msg, deadline: time.Now().Add(a.timeout)}
+	if len(a.pending) == 1 {
+		a.timer.Reset(a.timeout)
+	}
+}
+
+// untrack removes msg from flight without counting it as acked
+func (s *Sock) untrack(msg []byte) {
+	e, err := s.unwrap(msg)
+	if err != nil {
+		return
+	}
+
+	s.acks.mu.Lock()
+	delete(s.acks.pending, e.ID)
+	s.acks.mu.Unlock()
+}
+
+// sendTracked sends msg in flight, a batch of them included. it is not retried on error but stays in flight, so
+// it is redelivered on ack timeout by acker, the only owner of msg in flight
+func (s *Sock) sendTracked(msg []byte) {
+	if s.soc == nil {
+		log.Error().Err(fmt.Errorf("sock pointer is nil")).Msg("sock may closed, msg is redelivered on ack timeout")
+		return
+	}
+
+	frames, err := s.frames(msg)
+	if err != nil {
+		log.Error().Err(err).Bytes("data", msg).Msg("failed to build frames")
+		s.untrack(msg)
+		s.dead(msg, err, 0)
+
+		return
+	}
+
+	if err := s.send(s.soc, frames); err != nil {
+		log.Error().Err(err).Bytes("data", msg).Msg("failed to send, msg is redelivered on ack timeout")
+		return
+	}
+
+	s.sendMsgCount.Add(1)
+}
+
+// full reports whether window msg are in flight
+func (a *acker) full() bool {
+	if !a.tracking() {
+		return false
+	}
+
+	return a.Len() >= a.window
+}
+
+// ack removes msg in flight by the ids packed in buf
+func (a *acker) ack(buf []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := 0; i+12 <= len(buf); i += 12 {
+		id, err := xid.FromBytes(buf[i : i+12])
+		if err != nil {
+			continue
+		}
+
+		// ack of msg redelivered may arrive twice
+		if _, ok := a.pending[id]; ok {
+			delete(a.pending, id)
+			a.acked.Add(1)
+		}
+	}
+}
+
+// due removes msg which exceeded attempts, and resets deadline of others due, returns both of them
+func (a *acker) due(now time.Time, attempts uint8) (redeliver [][]byte, dead []*inflight) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var next time.Time
+	for id, f := range a.pending {
+		if f.deadline.After(now) {
+			if next.IsZero() || f.deadline.Before(next) {
+				next = f.deadline
+			}
+
+			continue
+		}
+
+		if f.attempts >= attempts {
+			delete(a.pending, id)
+			dead = append(dead, f)
+			continue
+		}
+
+		f.attempts++
+		f.deadline = now.Add(a.timeout)
+		redeliver = append(redeliver, f.msg)
+
+		if next.IsZero() || f.deadline.Before(next) {
+			next = f.deadline
+		}
+	}
+
+	if !next.IsZero() {
+		a.timer.Reset(next.Sub(now))
+	}
+
+	return redeliver, dead
+}
+
+// C receives acks packed by Ack, it is nil when acks are not tracked
+func (a *acker) C() <-chan []byte {
+	if !a.tracking() {
+		return nil
+	}
+
+	return a.link.GetOutChannel()
+}
+
+// expired fires when the earliest msg in flight may be due
+func (a *acker) expired() <-chan time.Time {
+	return a.timer.C
+}
+
+// Len gets the count of msg in flight
+func (a *acker) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.pending)
+}
+
+// drain removes and returns all msg in flight
+func (a *acker) drain() []*inflight {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	msgs := make([]*inflight, 0, len(a.pending))
+	for id, f := range a.pending {
+		msgs = append(msgs, f)
+		delete(a.pending, id)
+	}
+
+	return msgs
+}
+
+// redeliver sends again the msg not acked in timeout
+func (s *Sock) redeliver() {
+	msgs, dead := s.acks.due(time.Now(), s.RetryAttempts)
+
+	for _, f := range dead {
+		log.Warn().Str("id", s.ID).Msgf("msg not acked after %d redeliveries", f.attempts)
+		s.dead(f.msg, ErrAckTimeout, f.attempts)
+	}
+
+	for _, msg := range msgs {
+		s.acks.redelivered.Add(1)
+		s.sendTracked(msg)
+	}
+}
+
+// Ack confirms msgs received to their producers, socket must be created with WithAckConnect. acks are grouped by
+// ProducerID of Envelope and sent asynchronously
+func (s *Sock) Ack(msgs ...[]byte) error {
+	if s.acks.link == nil || s.acks.tracking() {
+		return fmt.Errorf("ack is not enabled by WithAckConnect")
+	}
+
+	ids := make(map[string][]byte)
+	for _, msg := range msgs {
+		e, err := s.unwrap(msg)
+		if err != nil {
+			return err
+		}
+
+		ids[e.ProducerID] = append(ids[e.ProducerID], e.ID.Bytes()...)
+	}
+
+	for producer, buf := range ids {
+		if err := s.acks.link.Put(NewTopicMsg(producer, buf)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetUnackedCount gets the count of msg in flight waiting for ack
+func (s *Sock) GetUnackedCount() int {
+	return s.acks.Len()
+}
+
+// GetAckedCount gets the total count of msg acked by consumers
+func (s *Sock) GetAckedCount() uint64 {
+	return s.acks.acked.Load()
+}
+
+// GetRedeliveredCount gets the total count of msg redelivered on ack timeout
+func (s *Sock) GetRedeliveredCount() uint64 {
+	return s.acks.redelivered.Load()
+}
@@ -0,0 +1,180 @@
+package sock
+
+import (
+	"github.com/rs/xid"
+	A "github.com/stretchr/testify/assert"
+	"github.com/zeromq/goczmq"
+	"testing"
+	"time"
+)
+
+func TestAckTrack(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://ack"),
+		WithAck("inproc://ack-link", time.Millisecond*50, 2),
+	)
+
+	assert.True(soc.envelope)
+	assert.Equal(soc.acks.link.Type, goczmq.Sub)
+
+	m1 := soc.wrap([]byte("a"), xid.NilID())
+	m2 := soc.wrap([]byte("b"), xid.NilID())
+	soc.track(m1)
+	assert.False(soc.acks.full())
+	soc.track(m2)
+	assert.True(soc.acks.full())
+	assert.Equal(soc.GetUnackedCount(), 2)
+	assert.False(soc.EmptyBuffer())
+
+	e1, _ := ParseEnvelope(m1)
+	soc.acks.ack(append(e1.ID.Bytes(), e1.ID.Bytes()...))
+	assert.Equal(soc.GetUnackedCount(), 1)
+	assert.Equal(soc.GetAckedCount(), uint64(1))
+
+	select {
+	case <-soc.acks.expired():
+	case <-time.After(time.Second):
+		assert.Fail("ack timer not fired")
+	}
+
+	now := time.Now()
+	msgs, dead := soc.acks.due(now, 1)
+	assert.Equal(msgs, [][]byte{m2})
+	assert.Nil(dead)
+
+	msgs, dead = soc.acks.due(now, 1)
+	assert.Nil(msgs)
+	assert.Nil(dead)
+
+	msgs, dead = soc.acks.due(now.Add(time.Millisecond*50), 1)
+	assert.Nil(msgs)
+	assert.Equal(len(dead), 1)
+	assert.Equal(dead[0].attempts, uint8(1))
+	assert.Equal(soc.GetUnackedCount(), 0)
+}
+
+func TestAckRedeliverDead(t *testing.T) {
+	assert := A.New(t)
+
+	var got []*DeadMsg
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://ack"),
+		WithAck("inproc://ack-link", time.Millisecond, 0),
+		WithRetryAttempts(0),
+		WithDeadLetter(DeadLetterFunc(func(m *DeadMsg) { got = append(got, m) })),
+	)
+
+	assert.Equal(soc.acks.window, DefaultAckWindow)
+
+	soc.track(soc.wrap([]byte("a"), xid.NilID()))
+	time.Sleep(time.Millisecond * 5)
+	soc.redeliver()
+
+	assert.Equal(len(got), 1)
+	assert.Equal(got[0].Err, ErrAckTimeout)
+	assert.Equal(soc.GetDropMsgCount(), uint64(1))
+	assert.Equal(soc.GetUnackedCount(), 0)
+}
+
+func TestAckRedeliverFailed(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://ack"),
+		WithAck("inproc://ack-link", time.Millisecond, 0),
+		WithRetryAttempts(3),
+	)
+
+	soc.track(soc.wrap([]byte("a"), xid.NilID()))
+	time.Sleep(time.Millisecond * 5)
+
+	// socket is not running, msg failed to send stays in flight and is not retried
+	soc.redeliver()
+
+	assert.Equal(soc.GetRedeliveredCount(), uint64(1))
+	assert.Equal(soc.GetUnackedCount(), 1)
+	assert.Equal(len(soc.retryCh), 0)
+}
+
+func TestAckDuplicate(t *testing.T) {
+	assert := A.New(t)
+
+	producer := New(WithType("Push"), WithEndpoint("inproc://ack"), WithProducerID("p1"), WithSequence())
+	consumer := New(
+		WithType("Pull"),
+		WithEndpoint("inproc://ack"),
+		WithMaxBufferSize(10),
+		WithAckConnect("inproc://ack-link"),
+		WithDedupe(0, nil),
+	)
+
+	m1 := producer.wrap([]byte("a"), xid.NilID())
+	consumer.deliver(m1)
+	assert.Equal(len(consumer.acks.link.GetInChannel()), 0)
+
+	// redelivery of m1 is dropped and acked again
+	consumer.deliver(m1)
+	assert.Equal(consumer.GetOutCount(), 1)
+	assert.Equal(consumer.GetDupMsgCount(), uint64(1))
+
+	m, err := ParseMessage(<-consumer.acks.link.GetInChannel())
+	assert.Nil(err)
+	assert.Equal(string(m[0]), "p1")
+
+	e1, _ := ParseEnvelope(m1)
+	assert.Equal(m[1], e1.ID.Bytes())
+}
+
+func TestAckConnect(t *testing.T) {
+	assert := A.New(t)
+
+	producer := New(WithType("Push"), WithEndpoint("inproc://ack"), WithProducerID("p1"), WithEnvelope())
+	consumer := New(WithType("Pull"), WithEndpoint("inproc://ack"), WithAckConnect("inproc://ack-link"))
+
+	m1 := producer.wrap([]byte("a"), xid.NilID())
+	m2 := producer.wrap([]byte("b"), xid.NilID())
+	assert.Nil(consumer.Ack(m1, m2))
+
+	m, err := ParseMessage(<-consumer.acks.link.GetInChannel())
+	assert.Nil(err)
+	assert.Equal(string(m[0]), "p1")
+
+	e1, _ := ParseEnvelope(m1)
+	e2, _ := ParseEnvelope(m2)
+	assert.Equal(m[1], append(e1.ID.Bytes(), e2.ID.Bytes()...))
+
+	assert.NotNil(consumer.Ack([]byte("no envelope")))
+	assert.NotNil(producer.Ack(m1))
+
+	assert.Panics(func() {
+		New(WithType("Pull"), WithEndpoint("inproc://ack"), WithAck("inproc://ack-link", 0, 0))
+	})
+
+	assert.Panics(func() {
+		New(WithType("Push"), WithEndpoint("inproc://ack"), WithAckConnect("inproc://ack-link"))
+	})
+}
+
+func TestAckReplaySpool(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://ack"),
+		WithAck("inproc://ack-link", time.Second, 0),
+		WithSpool(t.TempDir()),
+	)
+
+	assert.Nil(soc.openSpool())
+	assert.True(soc.spoolMsg(soc.wrap([]byte("a"), xid.NilID())))
+	soc.replaySpool()
+
+	// msg replayed is kept in flight even it failed to send
+	assert.Equal(soc.spool.Len(), 0)
+	assert.Equal(soc.GetUnackedCount(), 1)
+}
@@ -0,0 +1,237 @@
+package sock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/xid"
+	"github.com/zeromq/goczmq"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when the deadline of ctx exceeded before the call finished
+	ErrTimeout = errors.New("sock timeout")
+	// ErrClosed is returned when socket has been released
+	ErrClosed = errors.New("sock closed")
+	// ErrNoReply is returned when the peer sent no reply within RecvTimeoutSec
+	ErrNoReply = errors.New("sock no reply")
+)
+
+// ctxErr converts the error of ctx into sock error
+func ctxErr(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+
+	return ctx.Err()
+}
+
+// IsClosed reports whether socket has been released
+func (s *Sock) IsClosed() bool {
+	return s.closed.True()
+}
+
+// Done returns a channel which is closed when socket has been released
+func (s *Sock) Done() <-chan struct{} {
+	return s.done
+}
+
+// Ready waits until the run loop has attached the endpoints of socket and serves control funcs, so peers can
+// connect to the endpoints bound. the loop must be started, otherwise Ready waits until ctx is done
+func (s *Sock) Ready(ctx context.Context) error {
+	return s.call(ctx, func(soc *goczmq.Sock) error {
+		if soc == nil {
+			return ErrClosed
+		}
+
+		return nil
+	})
+}
+
+/*
+call runs f in the thread owning the zeromq socket and waits for its result.
+
+	f is skipped when ctx is done before it runs. the loop of socket must be running, otherwise call waits until
+	ctx is done
+*/
+func (s *Sock) call(ctx context.Context, f func(soc *goczmq.Sock) error) error {
+	if s.IsClosed() {
+		return ErrClosed
+	}
+
+	result := make(chan error, 1)
+	fn := func(soc *goczmq.Sock) {
+		if ctx.Err() != nil {
+			result <- ctxErr(ctx)
+			return
+		}
+
+		result <- f(soc)
+	}
+
+	select {
+	case s.ctl <- fn:
+	case <-s.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctxErr(ctx)
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-s.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctxErr(ctx)
+	}
+}
+
+// Send sends msg and waits until it is handed to zeromq. msg is not retried, the send error is returned to caller.
+// optional socket type: PUB/PUSH/ROUTER/DEALER
+func (s *Sock) Send(ctx context.Context, msg []byte) error {
+	return s.SendReply(ctx, msg, xid.NilID())
+}
+
+// SendReply sends msg like Send, correlation is the ID of request Envelope set as CorrelationID of the Envelope of
+// msg. it works as Send when socket is not created with WithEnvelope
+func (s *Sock) SendReply(ctx context.Context, msg []byte, correlation xid.ID) error {
+	switch s.Type {
+	case goczmq.Pub, goczmq.Push, goczmq.Router, goczmq.Dealer:
+	default:
+		return fmt.Errorf("send only enables by 'type': Pub/Push/Router/Dealer")
+	}
+
+	return s.call(ctx, func(soc *goczmq.Sock) error {
+		if soc == nil {
+			return ErrClosed
+		}
+
+		frames, err := s.frames(s.wrap(msg, correlation))
+		if err != nil {
+			return err
+		}
+
+		if err := s.send(soc, frames); err != nil {
+			return err
+		}
+
+		s.sendMsgCount.Add(1)
+
+		return nil
+	})
+}
+
+// Recv receives one msg from 'out' channel. optional socket type: SUB/PULL/ROUTER/DEALER
+func (s *Sock) Recv(ctx context.Context) ([]byte, error) {
+	switch s.Type {
+	case goczmq.Sub, goczmq.Pull, goczmq.Router, goczmq.Dealer:
+	default:
+		return nil, fmt.Errorf("recv only enables by 'type': Sub/Pull/Router/Dealer")
+	}
+
+	select {
+	case msg, ok := <-s.out:
+		if !ok {
+			return nil, ErrClosed
+		}
+
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctxErr(ctx)
+	}
+}
+
+// Request sends request msg and waits for its reply, ErrNoReply is returned when no reply in RecvTimeoutSec or
+// before the deadline of ctx. REQ socket is relaxed, so the next request can be sent after a lost reply and the
+// late reply is dropped. Requester must be running. optional socket type: REQ
+func (s *Sock) Request(ctx context.Context, msg []byte) ([]byte, error) {
+	if s.Type != goczmq.Req {
+		return nil, fmt.Errorf("request only enables by 'type': Req")
+	}
+
+	var reply []byte
+
+	err := s.call(ctx, func(soc *goczmq.Sock) error {
+		if soc == nil {
+			return ErrClosed
+		}
+
+		frames, err := s.frames(s.wrap(msg, xid.NilID()))
+		if err != nil {
+			return err
+		}
+
+		if err := s.send(soc, frames); err != nil {
+			return err
+		}
+
+		s.sendMsgCount.Add(1)
+
+		poller, err := goczmq.NewPoller(soc)
+		if err != nil {
+			return err
+		}
+		defer poller.Destroy()
+
+		ok, err := poll(ctx, poller, s.replyTimeout(ctx))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			log.Error().Msg("requester get no reply")
+			return ErrNoReply
+		}
+
+		reply, err = s.recvMsg(soc)
+		if err != nil {
+			log.Error().Err(err).Msg("requester failed to receive reply")
+			return ErrNoReply
+		}
+
+		s.recvMsgCount.Add(1)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// replyTimeout gets the time waiting for reply, it is RecvTimeoutSec bounded by the deadline of ctx
+func (s *Sock) replyTimeout(ctx context.Context) time.Duration {
+	timeout := time.Duration(s.RecvTimeoutSec) * time.Second
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); timeout <= 0 || left < timeout {
+			timeout = left
+		}
+	}
+
+	return timeout
+}
+
+// poll waits until a socket of poller is readable, timeout or ctx done. it waits until ctx done when timeout is
+// not positive
+func poll(ctx context.Context, poller *goczmq.Poller, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if ctx.Err() != nil {
+			return false, ctxErr(ctx)
+		}
+
+		if timeout > 0 && !time.Now().Before(deadline) {
+			return false, nil
+		}
+
+		if poller.Wait(DefaultPollTimeoutMillSec) != nil {
+			return true, nil
+		}
+	}
+}
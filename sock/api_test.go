@@ -0,0 +1,124 @@
+package sock
+
+import (
+	"context"
+	A "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecv(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Pull"),
+		WithEndpoint("inproc://api"),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	_, err := soc.Recv(ctx)
+	assert.Equal(err, ErrTimeout)
+
+	soc.GetOutChannel() <- []byte("hello")
+	msg, err := soc.Recv(context.Background())
+	assert.Nil(err)
+	assert.Equal(msg, []byte("hello"))
+
+	soc.release()
+	assert.True(soc.IsClosed())
+
+	_, err = soc.Recv(context.Background())
+	assert.Equal(err, ErrClosed)
+
+	_, err = soc.Request(context.Background(), []byte("hello"))
+	assert.NotNil(err)
+}
+
+func TestSendWithoutLoop(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://api"),
+	)
+
+	// no Publisher is running, Send waits until ctx done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	assert.Equal(soc.Send(ctx, []byte("hello")), ErrTimeout)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(soc.Send(ctx, []byte("hello")), context.Canceled)
+
+	soc.release()
+	assert.Equal(soc.Send(context.Background(), []byte("hello")), ErrClosed)
+	assert.Equal(soc.Put([]byte("hello")), ErrClosed)
+
+	_, err := soc.Recv(context.Background())
+	assert.NotNil(err)
+}
+
+func TestControl(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	soc := New(
+		WithCtx(ctx),
+		WithType("Sub"),
+		WithEndpoint("inproc://api"),
+	)
+
+	// no loop is running, control waits for room in buffer until ctx done
+	for i := 0; i < DefaultCtlBufferSize; i++ {
+		assert.Nil(soc.Subscribe("topic"))
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- soc.Subscribe("topic")
+	}()
+
+	select {
+	case <-result:
+		assert.Fail("control returned while buffer is full")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	cancel()
+	assert.Equal(<-result, context.Canceled)
+
+	soc.release()
+	assert.Equal(soc.Unsubscribe("topic"), ErrClosed)
+
+	assert.Panics(func() {
+		New(WithType("Router"), WithEndpoint("inproc://api"), WithTopic("topic"))
+	})
+}
+
+func TestReplyTimeout(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Req"),
+		WithEndpoint("inproc://api"),
+		WithRecvTimeoutSec(2),
+	)
+
+	assert.Equal(soc.replyTimeout(context.Background()), time.Second*2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+
+	timeout := soc.replyTimeout(ctx)
+	assert.True(timeout > 0 && timeout <= time.Millisecond*500)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	assert.Equal(soc.replyTimeout(ctx), time.Second*2)
+}
@@ -0,0 +1,229 @@
+package sock
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff gets the delay before the next retry, attempt is the count of failed retry
+type Backoff interface {
+	Next(attempt uint8) time.Duration
+}
+
+// ConstantBackoff waits the same interval between retries
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+// NewConstantBackoff creates a ConstantBackoff
+func NewConstantBackoff(interval time.Duration) *ConstantBackoff {
+	return &ConstantBackoff{Interval: interval}
+}
+
+// Next returns the interval
+func (b *ConstantBackoff) Next(attempt uint8) time.Duration {
+	return b.Interval
+}
+
+// ExponentialBackoff doubles the delay after every failed retry, the delay never exceeds Max
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// NewExponentialBackoff creates an ExponentialBackoff
+func NewExponentialBackoff(base time.Duration, max time.Duration) *ExponentialBackoff {
+	return &ExponentialBackoff{Base: base, Max: max}
+}
+
+// Next returns min(Max, Base * 2 ^ (attempt - 1))
+func (b *ExponentialBackoff) Next(attempt uint8) time.Duration {
+	return exponential(b.Base, b.Max, attempt)
+}
+
+// JitterBackoff is the exponential backoff with full jitter, the delay is random in [0, exponential delay]
+type JitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// NewJitterBackoff creates a JitterBackoff
+func NewJitterBackoff(base time.Duration, max time.Duration) *JitterBackoff {
+	return &JitterBackoff{Base: base, Max: max}
+}
+
+// Next returns random(0, min(Max, Base * 2 ^ (attempt - 1)))
+func (b *JitterBackoff) Next(attempt uint8) time.Duration {
+	d := exponential(b.Base, b.Max, attempt)
+	if d <= 0 {
+		return 0
+	}
+
+	// d + 1 overflows on the max duration
+	if d == math.MaxInt64 {
+		d--
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// exponential gets min(max, base * 2 ^ (attempt - 1)) without overflow
+func exponential(base time.Duration, max time.Duration, attempt uint8) time.Duration {
+	if attempt > 0 {
+		attempt--
+	}
+
+	d := base
+	for i := uint8(0); i < attempt; i++ {
+		if max > 0 && d >= max {
+			break
+		}
+
+		// stop doubling before overflow
+		if d >= time.Duration(1<<62) {
+			break
+		}
+
+		d *= 2
+	}
+
+	if max > 0 && d > max {
+		return max
+	}
+
+	return d
+}
+
+// WithBackoff sets the backoff policy between retries, ConstantBackoff with RetryInterval is used by default
+func WithBackoff(val Backoff) Option {
+	return func(s *Sock) {
+		s.backoff = val
+	}
+}
+
+type retryHeap []*RetryMsg
+
+func (h retryHeap) Len() int           { return len(h) }
+func (h retryHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h retryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *retryHeap) Push(x any) {
+	*h = append(*h, x.(*RetryMsg))
+}
+
+func (h *retryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return x
+}
+
+/*
+retryQueue holds retry msg until its backoff delay expires, so a waiting msg never stalls the socket thread.
+
+	the timer fires at the due time of the earliest msg, socket thread pops the due msg when C() fires
+*/
+type retryQueue struct {
+	mu    sync.Mutex
+	items retryHeap
+	timer *time.Timer
+}
+
+func newRetryQueue() *retryQueue {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+
+	return &retryQueue{timer: t}
+}
+
+// arm resets timer to fire at the due time of the earliest msg
+func (q *retryQueue) arm() {
+	if !q.timer.Stop() {
+		select {
+		case <-q.timer.C:
+		default:
+		}
+	}
+
+	if len(q.items) == 0 {
+		return
+	}
+
+	d := time.Until(q.items[0].due)
+	if d < 0 {
+		d = 0
+	}
+
+	q.timer.Reset(d)
+}
+
+// push adds msg which will be due after delay
+func (q *retryQueue) push(msg *RetryMsg, delay time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msg.due = time.Now().Add(delay)
+	heap.Push(&q.items, msg)
+
+	if q.items[0] == msg {
+		q.arm()
+	}
+}
+
+// pop removes and returns all due msg
+func (q *retryQueue) pop() []*RetryMsg {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	msgs := make([]*RetryMsg, 0)
+
+	for len(q.items) > 0 && !q.items[0].due.After(now) {
+		msgs = append(msgs, heap.Pop(&q.items).(*RetryMsg))
+	}
+
+	q.arm()
+
+	return msgs
+}
+
+// drain removes and returns all msg no matter they are due or not
+func (q *retryQueue) drain() []*RetryMsg {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msgs := make([]*RetryMsg, 0, len(q.items))
+	for len(q.items) > 0 {
+		msgs = append(msgs, heap.Pop(&q.items).(*RetryMsg))
+	}
+
+	q.arm()
+
+	return msgs
+}
+
+// C fires when the earliest msg is due
+func (q *retryQueue) C() <-chan time.Time {
+	return q.timer.C
+}
+
+// Len gets the count of waiting msg
+func (q *retryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// retryDue retries all due msg in retry queue
+func (s *Sock) retryDue() {
+	for _, msg := range s.delayed.pop() {
+		s.retry(s.soc, msg)
+	}
+}
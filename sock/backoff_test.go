@@ -0,0 +1,59 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	assert := A.New(t)
+
+	constant := NewConstantBackoff(time.Second)
+	assert.Equal(constant.Next(1), time.Second)
+	assert.Equal(constant.Next(10), time.Second)
+
+	exp := NewExponentialBackoff(time.Millisecond*100, time.Second)
+	assert.Equal(exp.Next(1), time.Millisecond*100)
+	assert.Equal(exp.Next(2), time.Millisecond*200)
+	assert.Equal(exp.Next(4), time.Millisecond*800)
+	assert.Equal(exp.Next(5), time.Second)
+	assert.Equal(exp.Next(255), time.Second)
+
+	jitter := NewJitterBackoff(time.Millisecond*100, time.Second)
+	for i := uint8(1); i < 10; i++ {
+		d := jitter.Next(i)
+		assert.True(d >= 0)
+		assert.True(d <= exp.Next(i))
+	}
+
+	// no cap never overflows
+	assert.True(NewExponentialBackoff(time.Second, 0).Next(255) > 0)
+	assert.Equal(NewExponentialBackoff(time.Duration(1<<62), 0).Next(3), time.Duration(1<<62))
+	assert.True(NewJitterBackoff(time.Duration(math.MaxInt64), 0).Next(1) >= 0)
+}
+
+func TestRetryQueue(t *testing.T) {
+	assert := A.New(t)
+
+	q := newRetryQueue()
+	q.push(NewRetryMsg([]byte("b"), 3), time.Millisecond*100)
+	q.push(NewRetryMsg([]byte("a"), 3), time.Millisecond*50)
+	q.push(NewRetryMsg([]byte("c"), 3), time.Hour)
+
+	assert.Equal(q.Len(), 3)
+	assert.Equal(len(q.pop()), 0)
+
+	<-q.C()
+	time.Sleep(time.Millisecond * 100)
+
+	msgs := q.pop()
+	assert.Equal(len(msgs), 2)
+	assert.Equal(msgs[0].Msg, []byte("a"))
+	assert.Equal(msgs[1].Msg, []byte("b"))
+	assert.Equal(q.Len(), 1)
+
+	assert.Equal(len(q.drain()), 1)
+	assert.Equal(q.Len(), 0)
+}
@@ -0,0 +1,169 @@
+package sock
+
+import (
+	"context"
+	"errors"
+	"github.com/lafrinte/nops/timer"
+	"sync/atomic"
+	"time"
+)
+
+// Overflow is the policy applied when 'in' or 'out' channel is full
+type Overflow uint8
+
+const (
+	// OverflowBlock waits until buffer has room, it is the default policy
+	OverflowBlock Overflow = iota
+	// OverflowBlockTimeout waits until buffer has room or timeout, msg is dropped on timeout
+	OverflowBlockTimeout
+	// OverflowDropNewest drops the msg being put
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest msg in buffer to make room for the msg being put
+	OverflowDropOldest
+)
+
+// ErrBufferFull is returned when msg is dropped by overflow policy
+var ErrBufferFull = errors.New("buffer is full")
+
+// OverflowStats is the counters of overflow policy
+type OverflowStats struct {
+	// Blocked is the count of put waited for room, applies to OverflowBlock and OverflowBlockTimeout
+	Blocked uint64
+	// Timeout is the count of msg dropped on timeout, applies to OverflowBlockTimeout
+	Timeout uint64
+	// DropNewest is the count of msg dropped on put, applies to OverflowDropNewest
+	DropNewest uint64
+	// DropOldest is the count of msg dropped from buffer, applies to OverflowDropOldest
+	DropOldest uint64
+}
+
+// overflow applies policy on putting msg into a buffered channel
+type overflow struct {
+	policy  Overflow
+	timeout time.Duration
+
+	blocked    atomic.Uint64
+	timeouts   atomic.Uint64
+	dropNewest atomic.Uint64
+	dropOldest atomic.Uint64
+}
+
+// put puts msg into ch by policy, returns ErrBufferFull when msg is dropped and ErrClosed when done is closed
+// while waiting. every msg dropped, the one being put or the oldest in buffer, is passed to drop
+func (o *overflow) put(ctx context.Context, done <-chan struct{}, ch chan []byte, msg []byte, drop func([]byte)) error {
+	select {
+	case ch <- msg:
+		return nil
+	default:
+	}
+
+	policy := o.policy
+
+	// nothing can be dropped from an unbuffered channel
+	if policy == OverflowDropOldest && cap(ch) == 0 {
+		policy = OverflowDropNewest
+	}
+
+	switch policy {
+	case OverflowBlockTimeout:
+		o.blocked.Add(1)
+
+		t := timer.AcquireTimer(o.timeout)
+		defer timer.ReleaseTimer(t)
+
+		select {
+		case ch <- msg:
+			return nil
+		case <-t.C:
+			o.timeouts.Add(1)
+			drop(msg)
+			return ErrBufferFull
+		case <-done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case OverflowDropNewest:
+		o.dropNewest.Add(1)
+		drop(msg)
+		return ErrBufferFull
+	case OverflowDropOldest:
+		for {
+			select {
+			case old := <-ch:
+				o.dropOldest.Add(1)
+				drop(old)
+			default:
+			}
+
+			select {
+			case ch <- msg:
+				return nil
+			default:
+			}
+		}
+	default:
+		o.blocked.Add(1)
+
+		select {
+		case ch <- msg:
+			return nil
+		case <-done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// stats gets a snapshot of counters
+func (o *overflow) stats() OverflowStats {
+	return OverflowStats{
+		Blocked:    o.blocked.Load(),
+		Timeout:    o.timeouts.Load(),
+		DropNewest: o.dropNewest.Load(),
+		DropOldest: o.dropOldest.Load(),
+	}
+}
+
+// WithInOverflow sets the policy applied by Put when 'in' channel is full, timeout works with OverflowBlockTimeout
+func WithInOverflow(policy Overflow, timeout time.Duration) Option {
+	return func(s *Sock) {
+		s.inOverflow.policy = policy
+		s.inOverflow.timeout = timeout
+	}
+}
+
+// WithOutOverflow sets the policy applied by the receive loop when 'out' channel is full, timeout works with
+// OverflowBlockTimeout
+func WithOutOverflow(policy Overflow, timeout time.Duration) Option {
+	return func(s *Sock) {
+		s.outOverflow.policy = policy
+		s.outOverflow.timeout = timeout
+	}
+}
+
+// Put puts msg into 'in' channel by the overflow policy set by WithInOverflow. writing into GetInChannel directly
+// always blocks when channel is full. msg dropped by the policy goes to dead letter
+func (s *Sock) Put(msg []byte) error {
+	if s.IsClosed() {
+		return ErrClosed
+	}
+
+	return s.inOverflow.put(s.ctx, s.done, s.in, msg, s.dropped)
+}
+
+// dropped passes msg dropped by overflow policy to dead letter
+func (s *Sock) dropped(msg []byte) {
+	s.dead(msg, ErrBufferFull, 0)
+}
+
+// GetInOverflowStats gets the counters of overflow policy on 'in' channel
+func (s *Sock) GetInOverflowStats() OverflowStats {
+	return s.inOverflow.stats()
+}
+
+// GetOutOverflowStats gets the counters of overflow policy on 'out' channel
+func (s *Sock) GetOutOverflowStats() OverflowStats {
+	return s.outOverflow.stats()
+}
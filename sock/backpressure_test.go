@@ -0,0 +1,103 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOverflowDropNewest(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://overflow"),
+		WithMaxBufferSize(2),
+		WithInOverflow(OverflowDropNewest, 0),
+	)
+
+	assert.Nil(soc.Put([]byte("a")))
+	assert.Nil(soc.Put([]byte("b")))
+	assert.Equal(soc.Put([]byte("c")), ErrBufferFull)
+
+	assert.Equal(soc.GetInOverflowStats().DropNewest, uint64(1))
+	assert.Equal(soc.GetDropMsgCount(), uint64(1))
+	assert.Equal(<-soc.GetInChannel(), []byte("a"))
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://overflow"),
+		WithMaxBufferSize(2),
+		WithInOverflow(OverflowDropOldest, 0),
+	)
+
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		assert.Nil(soc.Put([]byte(msg)))
+	}
+
+	assert.Equal(soc.GetInOverflowStats().DropOldest, uint64(2))
+	assert.Equal(soc.GetDropMsgCount(), uint64(2))
+	assert.Equal(<-soc.GetInChannel(), []byte("c"))
+	assert.Equal(<-soc.GetInChannel(), []byte("d"))
+}
+
+func TestOverflowBlockTimeout(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://overflow"),
+		WithMaxBufferSize(1),
+		WithInOverflow(OverflowBlockTimeout, time.Millisecond*50),
+	)
+
+	assert.Nil(soc.Put([]byte("a")))
+
+	start := time.Now()
+	assert.Equal(soc.Put([]byte("b")), ErrBufferFull)
+	assert.True(time.Since(start) >= time.Millisecond*50)
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		<-soc.GetInChannel()
+	}()
+
+	assert.Nil(soc.Put([]byte("c")))
+
+	stats := soc.GetInOverflowStats()
+	assert.Equal(stats.Blocked, uint64(2))
+	assert.Equal(stats.Timeout, uint64(1))
+	assert.Equal(soc.GetDropMsgCount(), uint64(1))
+}
+
+func TestOverflowRelease(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://overflow"),
+		WithMaxBufferSize(1),
+	)
+
+	assert.Nil(soc.Put([]byte("a")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(soc.Put([]byte("b")), ErrClosed)
+		}()
+	}
+
+	time.Sleep(time.Millisecond * 10)
+	soc.release()
+	wg.Wait()
+
+	assert.Equal(soc.Put([]byte("c")), ErrClosed)
+}
@@ -0,0 +1,339 @@
+package sock
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/xid"
+	"github.com/zeromq/goczmq"
+	"io"
+	"sync"
+	"time"
+)
+
+// Compression is the algorithm compressing batch frame
+type Compression byte
+
+const (
+	CompressNone Compression = iota
+	CompressGzip
+	CompressSnappy
+	CompressZstd
+)
+
+const (
+	DefaultBatchCount  = 100
+	DefaultBatchBytes  = 64 * 1024
+	DefaultBatchLinger = time.Millisecond * 10
+
+	batchVersion    = 1
+	batchHeaderSize = 5
+)
+
+// batchMagic is the leading bytes of batch frame, the first zero byte keeps it away from text msg
+var batchMagic = []byte{0, 'N', 'B'}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressNone:
+		return "none"
+	case CompressGzip:
+		return "gzip"
+	case CompressSnappy:
+		return "snappy"
+	case CompressZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// initZstd creates the process-wide zstd encoder and decoder, both are safe for concurrent EncodeAll/DecodeAll
+func initZstd() {
+	zstdOnce.Do(func() {
+		var err error
+		if zstdEncoder, err = zstd.NewWriter(nil); err != nil {
+			panic(fmt.Errorf("failed to create zstd encoder: %w", err))
+		}
+
+		if zstdDecoder, err = zstd.NewReader(nil); err != nil {
+			panic(fmt.Errorf("failed to create zstd decoder: %w", err))
+		}
+	})
+}
+
+func compress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressNone:
+		return data, nil
+	case CompressGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case CompressSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressZstd:
+		initZstd()
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %d", byte(c))
+	}
+}
+
+func decompress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressNone:
+		return data, nil
+	case CompressGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		defer r.Close()
+
+		return io.ReadAll(r)
+	case CompressSnappy:
+		return snappy.Decode(nil, data)
+	case CompressZstd:
+		initZstd()
+		return zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unknown compression %d", byte(c))
+	}
+}
+
+/*
+NewBatch packs msgs into one batch frame, the payload is Message.Bytes() of msgs compressed by c
+
+	| 3 bytes magic 0x00 'N' 'B' | 1 byte version | 1 byte compression | payload |
+*/
+func NewBatch(msgs [][]byte, c Compression) ([]byte, error) {
+	payload, err := compress(c, Message(msgs).Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, batchHeaderSize+len(payload))
+	buf = append(buf, batchMagic...)
+	buf = append(buf, batchVersion, byte(c))
+	buf = append(buf, payload...)
+
+	return buf, nil
+}
+
+// IsBatch reports whether buf starts with the batch header
+func IsBatch(buf []byte) bool {
+	return len(buf) >= batchHeaderSize && bytes.Equal(buf[:len(batchMagic)], batchMagic) && buf[3] == batchVersion
+}
+
+// ParseBatch unpacks the batch frame created by NewBatch into msgs
+func ParseBatch(buf []byte) ([][]byte, error) {
+	if !IsBatch(buf) {
+		return nil, fmt.Errorf("malformed batch: no batch header")
+	}
+
+	payload, err := decompress(Compression(buf[4]), buf[batchHeaderSize:])
+	if err != nil {
+		return nil, fmt.Errorf("malformed batch: %w", err)
+	}
+
+	m, err := ParseMessage(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed batch: %w", err)
+	}
+
+	return m, nil
+}
+
+/*
+WithBatch makes Publisher send msg in 'in' channel as batch frames, a batch is flushed when it has count msg,
+its size reaches bytes, or linger passed since its first msg. zero value uses the default.
+
+	Consumer unpacks batch frames into 'out' channel transparently. batching is ignored on multipart socket,
+	the send counter of publisher counts batch frames instead of msg
+*/
+func WithBatch(count, bytes int, linger time.Duration) Option {
+	return func(s *Sock) {
+		if count <= 0 {
+			count = DefaultBatchCount
+		}
+
+		if bytes <= 0 {
+			bytes = DefaultBatchBytes
+		}
+
+		if linger <= 0 {
+			linger = DefaultBatchLinger
+		}
+
+		s.batch.count = count
+		s.batch.bytes = bytes
+		s.batch.linger = linger
+	}
+}
+
+// WithCompression compresses batch frames by c, every msg is sent as a batch of one when WithBatch is not set
+func WithCompression(c Compression) Option {
+	return func(s *Sock) {
+		s.batch.compression = c
+	}
+}
+
+// batcher collects msg into batch in the thread owning socket, Len may be called from any thread
+type batcher struct {
+	mu          sync.Mutex
+	count       int
+	bytes       int
+	linger      time.Duration
+	compression Compression
+
+	msgs  [][]byte
+	size  int
+	timer *time.Timer
+}
+
+func newBatcher() *batcher {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+
+	return &batcher{timer: t}
+}
+
+// enabled reports whether msg is sent as batch frame
+func (b *batcher) enabled() bool {
+	return b.count > 0 || b.compression != CompressNone
+}
+
+// add appends msg into batch, returns true when batch is full and should be flushed
+func (b *batcher) add(msg []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.msgs = append(b.msgs, msg)
+	b.size += len(msg)
+
+	if len(b.msgs) == 1 && b.linger > 0 {
+		b.timer.Reset(b.linger)
+	}
+
+	return len(b.msgs) >= b.count || b.size >= b.bytes
+}
+
+// take removes and returns all msg in batch
+func (b *batcher) take() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.timer.Stop() {
+		select {
+		case <-b.timer.C:
+		default:
+		}
+	}
+
+	msgs := b.msgs
+	b.msgs = nil
+	b.size = 0
+
+	return msgs
+}
+
+// C fires when linger passed since the first msg of batch
+func (b *batcher) C() <-chan time.Time {
+	return b.timer.C
+}
+
+// Len gets the count of msg in batch
+func (b *batcher) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.msgs)
+}
+
+// GetBatchCount gets the count of msg waiting in batch
+func (s *Sock) GetBatchCount() int {
+	return s.batch.Len()
+}
+
+// publish sends msg of 'in' channel, it is added into batch when batching enabled
+func (s *Sock) publish(msg []byte) {
+	msg = s.wrap(msg, xid.NilID())
+	s.track(msg)
+
+	if s.multipart || !s.batch.enabled() || (s.Type != goczmq.Pub && s.Type != goczmq.Push) {
+		if s.acks.tracking() {
+			s.sendTracked(msg)
+			return
+		}
+
+		_ = s.sendFrame(s.soc, msg, true)
+		return
+	}
+
+	if s.batch.add(msg) {
+		s.flush()
+	}
+}
+
+// flush sends all msg in batch as one batch frame
+func (s *Sock) flush() {
+	msgs := s.batch.take()
+	if len(msgs) == 0 {
+		return
+	}
+
+	buf, err := NewBatch(msgs, s.batch.compression)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to pack batch of %d msg", len(msgs))
+		for _, msg := range msgs {
+			s.dead(msg, err, 0)
+		}
+
+		return
+	}
+
+	if s.acks.tracking() {
+		s.sendTracked(buf)
+		return
+	}
+
+	_ = s.sendFrame(s.soc, buf, true)
+}
+
+// unbatch unpacks batch frame sent by socket, so msg in a batch failed to send goes to spool or dead letter one
+// by one. false is returned when buf is not a batch frame
+func (s *Sock) unbatch(buf []byte) ([][]byte, bool) {
+	if s.multipart || (s.Type != goczmq.Pub && s.Type != goczmq.Push) || !IsBatch(buf) {
+		return nil, false
+	}
+
+	msgs, err := ParseBatch(buf)
+	if err != nil {
+		return nil, false
+	}
+
+	return msgs, true
+}
+
+// isBatch reports whether received buf is a batch frame, batch is only sent by PUB/PUSH without multipart
+func (s *Sock) isBatch(buf []byte) bool {
+	return !s.multipart && (s.Type == goczmq.Sub || s.Type == goczmq.Pull) && IsBatch(buf)
+}
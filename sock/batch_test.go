@@ -0,0 +1,81 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	assert := A.New(t)
+
+	msgs := make([][]byte, 0, 100)
+	for i := 0; i < 100; i++ {
+		msgs = append(msgs, []byte("telemetry "+strconv.Itoa(i)))
+	}
+
+	for _, c := range []Compression{CompressNone, CompressGzip, CompressSnappy, CompressZstd} {
+		buf, err := NewBatch(msgs, c)
+		assert.Nil(err, c.String())
+		assert.True(IsBatch(buf))
+		assert.Equal(Compression(buf[4]), c)
+
+		parsed, err := ParseBatch(buf)
+		assert.Nil(err, c.String())
+		assert.Equal(len(parsed), 100)
+		assert.Equal(parsed[99], []byte("telemetry 99"))
+	}
+
+	buf, _ := NewBatch(msgs, CompressZstd)
+	_, err := ParseBatch(buf[:len(buf)-4])
+	assert.NotNil(err)
+
+	_, err = NewBatch(msgs, Compression(9))
+	assert.NotNil(err)
+
+	assert.False(IsBatch([]byte("NB")))
+	assert.False(IsBatch([]byte("telemetry")))
+	assert.Equal(Compression(9).String(), "unknown(9)")
+}
+
+func TestBatcher(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(WithType("PUSH"), WithEndpoint("inproc://batch"), WithBatch(3, 10, time.Millisecond*50))
+	assert.True(soc.batch.enabled())
+
+	assert.False(soc.batch.add([]byte("a")))
+	assert.False(soc.batch.add([]byte("b")))
+	assert.True(soc.batch.add([]byte("c")))
+	assert.Equal(soc.batch.Len(), 3)
+	assert.False(soc.EmptyBuffer())
+
+	assert.Equal(len(soc.batch.take()), 3)
+	assert.True(soc.EmptyBuffer())
+
+	// flushed by bytes
+	assert.True(soc.batch.add([]byte("0123456789")))
+	soc.batch.take()
+
+	// flushed by linger
+	soc.batch.add([]byte("a"))
+	select {
+	case <-soc.batch.C():
+	case <-time.After(time.Second):
+		t.Error("linger timer not fired")
+	}
+
+	assert.Equal(len(soc.batch.take()), 1)
+
+	soc = New(WithType("PUSH"), WithEndpoint("inproc://batch"), WithCompression(CompressSnappy))
+	assert.True(soc.batch.enabled())
+	assert.True(soc.batch.add([]byte("a")))
+
+	soc = New(WithType("PULL"), WithEndpoint("inproc://batch"))
+	assert.False(soc.batch.enabled())
+
+	buf, _ := NewBatch([][]byte{[]byte("a")}, CompressNone)
+	assert.True(soc.isBatch(buf))
+	assert.False(New(WithType("PULL"), WithEndpoint("inproc://batch"), WithMultipart()).isBatch(buf))
+}
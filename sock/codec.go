@@ -0,0 +1,85 @@
+package sock
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes value into msg and decodes msg into value, v of Unmarshal must be a pointer
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// ProtoCodec encodes proto.Message by protobuf
+type ProtoCodec struct{}
+
+func (ProtoCodec) Name() string {
+	return "proto"
+}
+
+func (ProtoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("proto codec: %T is not proto.Message", v)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("proto codec: %T is not proto.Message", v)
+	}
+
+	return proto.Unmarshal(data, m)
+}
+
+// JSONCodec encodes value by encoding/json
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// RawCodec passes []byte and string through without encoding
+type RawCodec struct{}
+
+func (RawCodec) Name() string {
+	return "raw"
+}
+
+func (RawCodec) Marshal(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	default:
+		return nil, fmt.Errorf("raw codec: unsupported type %T", v)
+	}
+}
+
+func (RawCodec) Unmarshal(data []byte, v any) error {
+	switch val := v.(type) {
+	case *[]byte:
+		*val = data
+	case *string:
+		*val = string(data)
+	default:
+		return fmt.Errorf("raw codec: unsupported type %T", v)
+	}
+
+	return nil
+}
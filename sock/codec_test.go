@@ -0,0 +1,118 @@
+package sock
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/xid"
+	A "github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+	"time"
+)
+
+type metric struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+func TestCodec(t *testing.T) {
+	assert := A.New(t)
+
+	buf, err := ProtoCodec{}.Marshal(wrapperspb.String("hello"))
+	assert.Nil(err)
+
+	v := &wrapperspb.StringValue{}
+	assert.Nil(ProtoCodec{}.Unmarshal(buf, v))
+	assert.True(proto.Equal(v, wrapperspb.String("hello")))
+
+	_, err = ProtoCodec{}.Marshal("hello")
+	assert.NotNil(err)
+
+	buf, err = JSONCodec{}.Marshal(metric{Name: "cpu", Value: 0.5})
+	assert.Nil(err)
+
+	m := metric{}
+	assert.Nil(JSONCodec{}.Unmarshal(buf, &m))
+	assert.Equal(m, metric{Name: "cpu", Value: 0.5})
+
+	buf, err = RawCodec{}.Marshal("hello")
+	assert.Nil(err)
+
+	var s string
+	assert.Nil(RawCodec{}.Unmarshal(buf, &s))
+	assert.Equal(s, "hello")
+
+	_, err = RawCodec{}.Marshal(1)
+	assert.NotNil(err)
+}
+
+func TestTypedSockDecode(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint("inproc://typed"),
+	)
+
+	typed := NewTypedSock[*wrapperspb.StringValue](pull, ProtoCodec{})
+
+	buf, _ := proto.Marshal(wrapperspb.String("hello"))
+	pull.GetOutChannel() <- []byte{0xff, 0xff}
+	pull.GetOutChannel() <- buf
+
+	v, err := typed.Recv(ctx)
+	assert.Nil(err)
+	assert.Equal(v.GetValue(), "hello")
+
+	err = <-typed.Errors()
+	codecErr := &CodecError{}
+	assert.True(errors.As(err, &codecErr))
+	assert.Equal(codecErr.Msg, []byte{0xff, 0xff})
+
+	jsonTyped := NewTypedSock[metric](New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint("inproc://typed-json"),
+	), JSONCodec{})
+
+	jsonTyped.GetSock().GetOutChannel() <- []byte(`{"name":"cpu","value":0.5}`)
+
+	m, err := jsonTyped.Recv(ctx)
+	assert.Nil(err)
+	assert.Equal(m, metric{Name: "cpu", Value: 0.5})
+}
+
+func TestTypedSockEnvelope(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+
+	producer := New(WithType("Push"), WithEndpoint("inproc://typed-envelope"), WithEnvelope())
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint("inproc://typed-envelope"),
+		WithEnvelope(),
+	)
+
+	typed := NewTypedSock[metric](pull, JSONCodec{})
+
+	pull.GetOutChannel() <- []byte(`{"name":"cpu","value":0.5}`)
+	pull.GetOutChannel() <- producer.wrap([]byte(`{"name":"mem","value":0.7}`), xid.NilID())
+
+	m, err := typed.Recv(ctx)
+	assert.Nil(err)
+	assert.Equal(m, metric{Name: "mem", Value: 0.7})
+
+	// msg without Envelope is reported
+	err = <-typed.Errors()
+	codecErr := &CodecError{}
+	assert.True(errors.As(err, &codecErr))
+	assert.Equal(codecErr.Msg, []byte(`{"name":"cpu","value":0.5}`))
+}
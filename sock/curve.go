@@ -0,0 +1,375 @@
+package sock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/zeromq/goczmq"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CurveKeySize is the length of a z85 encoded CURVE key
+const CurveKeySize = 40
+
+// CurveCert is a CURVE keypair in z85 text, SecretKey is empty when loaded from a public cert
+type CurveCert struct {
+	PublicKey string
+	SecretKey string
+}
+
+/*
+GenerateCurveKeypair generates a new CURVE keypair and saves it in ZeroMQ cert format. the public cert is
+saved in filename and the secret cert is saved in filename_secret, returns the generated keypair.
+
+	hand out the public cert to peers, keep the secret cert on local
+*/
+func GenerateCurveKeypair(filename string) (*CurveCert, error) {
+	if dir := filepath.Dir(filename); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	cert := goczmq.NewCert()
+	defer cert.Destroy()
+
+	if err := cert.Save(filename); err != nil {
+		return nil, err
+	}
+
+	return LoadCurveCert(filename)
+}
+
+/*
+LoadCurveCert loads CURVE keypair from file in ZeroMQ cert format. filename_secret is tried first like
+zcert_load, filename is loaded when secret cert does not exist.
+
+	curve
+	    public-key = "..."
+	    secret-key = "..."
+*/
+func LoadCurveCert(filename string) (*CurveCert, error) {
+	if _, err := os.Stat(filename + "_secret"); err == nil {
+		filename = filename + "_secret"
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	cert := &CurveCert{}
+	section := ""
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// sections begin at column 0, properties are indented
+		if trimmed == line {
+			section = trimmed
+			continue
+		}
+
+		if section != "curve" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+
+		val = strings.Trim(strings.TrimSpace(val), `"`)
+		switch strings.TrimSpace(key) {
+		case "public-key":
+			cert.PublicKey = val
+		case "secret-key":
+			cert.SecretKey = val
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cert.PublicKey) != CurveKeySize {
+		return nil, fmt.Errorf("invalid public key in cert %s", filename)
+	}
+
+	if cert.SecretKey != "" && len(cert.SecretKey) != CurveKeySize {
+		return nil, fmt.Errorf("invalid secret key in cert %s", filename)
+	}
+
+	return cert, nil
+}
+
+const (
+	zapEndpoint = "inproc://zeromq.zap.01"
+	z85Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+	zapRecvTimeoutMillSec = 100
+	// receives failed before timeout in a row when the context of zeromq is terminated
+	zapMaxFastFailures = 3
+)
+
+/*
+curveAuth is the ZAP handler of process, only one handler can be bound on zapEndpoint per process. every
+socket with an allowlist authenticates its clients in its own ZAP domain, so the allowlist of one socket never
+applies to another. clients of a domain without allowlist are accepted.
+
+	handler stops when no domain is left or the context of zeromq is terminated, it is started again by allow
+*/
+type curveAuth struct {
+	mu      sync.Mutex
+	handler *goczmq.Sock
+	domains map[string]map[string]struct{}
+}
+
+var zap = &curveAuth{domains: make(map[string]map[string]struct{})}
+
+// allow sets the allowlist of client public keys of domain and starts ZAP handler when it is not running
+func (a *curveAuth) allow(domain string, keys []string) error {
+	allowed := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if len(key) != CurveKeySize {
+			return fmt.Errorf("invalid client public key: %s", key)
+		}
+
+		allowed[key] = struct{}{}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.handler == nil {
+		handler, err := goczmq.NewRep(zapEndpoint)
+		if err != nil {
+			return fmt.Errorf("failed to bind zap handler: %w", err)
+		}
+
+		handler.SetRcvtimeo(zapRecvTimeoutMillSec)
+		a.handler = handler
+		go a.run(handler)
+	}
+
+	a.domains[domain] = allowed
+
+	return nil
+}
+
+// remove drops the allowlist of domain when socket is released
+func (a *curveAuth) remove(domain string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.domains, domain)
+}
+
+// authorized reports whether client with public key in z85 is accepted in domain
+func (a *curveAuth) authorized(domain string, key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keys, ok := a.domains[domain]
+	if !ok {
+		return true
+	}
+
+	_, ok = keys[key]
+
+	return ok
+}
+
+// stop destroys handler when no domain is left or force is true, it reports whether handler is stopped
+func (a *curveAuth) stop(handler *goczmq.Sock, force bool) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !force && len(a.domains) > 0 {
+		return false
+	}
+
+	// zapEndpoint is unbound before a new handler can be created by allow
+	handler.Destroy()
+	a.handler = nil
+
+	return true
+}
+
+/*
+run replies ZAP requests until handler is stopped
+
+	request: | version | request id | domain | address | identity | mechanism | credentials ... |
+	reply:   | version | request id | status code | status text | user id | metadata |
+*/
+func (a *curveAuth) run(handler *goczmq.Sock) {
+	timeout := time.Duration(zapRecvTimeoutMillSec) * time.Millisecond
+	failures := 0
+
+	for {
+		start := time.Now()
+
+		frames, err := handler.RecvMessage()
+		if errors.Is(err, goczmq.ErrRecvFrameAfterDestroy) {
+			return
+		}
+
+		if err != nil {
+			// receive timeout, a receive failed at once is interrupted or the context of zeromq is terminated
+			failures++
+			if time.Since(start) >= timeout/2 {
+				failures = 0
+			}
+
+			if failures >= zapMaxFastFailures {
+				log.Error().Err(err).Msg("zap handler stopped on receive error")
+				a.stop(handler, true)
+				return
+			}
+
+			if a.stop(handler, false) {
+				return
+			}
+
+			continue
+		}
+
+		failures = 0
+
+		if len(frames) < 6 {
+			log.Error().Msgf("malformed zap request of %d frames", len(frames))
+			continue
+		}
+
+		code, text := "200", "OK"
+		if string(frames[5]) == "CURVE" {
+			if len(frames) < 7 || !a.authorized(string(frames[2]), z85Encode(frames[6])) {
+				code, text = "400", "client key not allowed"
+			}
+		}
+
+		reply := [][]byte{frames[0], frames[1], []byte(code), []byte(text), {}, {}}
+		if err := handler.SendMessage(reply); err != nil {
+			log.Error().Err(err).Msg("failed to send zap reply")
+		}
+	}
+}
+
+// z85Encode encodes data whose length is a multiple of 4 by ZeroMQ Base-85
+func z85Encode(data []byte) string {
+	buf := make([]byte, 0, len(data)/4*5)
+	for i := 0; i+4 <= len(data); i += 4 {
+		val := uint32(data[i])<<24 | uint32(data[i+1])<<16 | uint32(data[i+2])<<8 | uint32(data[i+3])
+
+		var chunk [5]byte
+		for j := 4; j >= 0; j-- {
+			chunk[j] = z85Alphabet[val%85]
+			val /= 85
+		}
+
+		buf = append(buf, chunk[:]...)
+	}
+
+	return string(buf)
+}
+
+// WithCurveServer enables CURVE on socket as server with the keypair loaded from cert file
+func WithCurveServer(certFile string) Option {
+	return func(s *Sock) {
+		cert, err := LoadCurveCert(certFile)
+		if err != nil {
+			panic(fmt.Errorf("failed to load curve server cert: %w", err))
+		}
+
+		if cert.SecretKey == "" {
+			panic(fmt.Errorf("no secret key in curve server cert: %s", certFile))
+		}
+
+		s.curveServer = true
+		s.curveCert = cert
+	}
+}
+
+// WithCurveClient enables CURVE on socket as client with the keypair loaded from cert file and the public key
+// of server loaded from server public cert file
+func WithCurveClient(certFile string, serverCertFile string) Option {
+	return func(s *Sock) {
+		cert, err := LoadCurveCert(certFile)
+		if err != nil {
+			panic(fmt.Errorf("failed to load curve client cert: %w", err))
+		}
+
+		if cert.SecretKey == "" {
+			panic(fmt.Errorf("no secret key in curve client cert: %s", certFile))
+		}
+
+		server, err := LoadCurveCert(serverCertFile)
+		if err != nil {
+			panic(fmt.Errorf("failed to load curve server cert: %w", err))
+		}
+
+		s.curveServer = false
+		s.curveCert = cert
+		s.curveServerKey = server.PublicKey
+	}
+}
+
+// WithCurveAllow only accepts CURVE clients whose public key is in keys. it works with WithCurveServer,
+// all clients knowing the server public key are accepted when no allowlist is set on the socket
+func WithCurveAllow(keys ...string) Option {
+	return func(s *Sock) {
+		s.curveAllow = append(s.curveAllow, keys...)
+	}
+}
+
+// setCurve applies CURVE options on socket
+func (s *Sock) setCurve(soc *goczmq.Sock) {
+	if s.curveCert == nil {
+		return
+	}
+
+	soc.SetCurvePublickey(s.curveCert.PublicKey)
+	soc.SetCurveSecretkey(s.curveCert.SecretKey)
+
+	if !s.curveServer {
+		soc.SetCurveServerkey(s.curveServerKey)
+		return
+	}
+
+	if len(s.curveAllow) > 0 {
+		if err := zap.allow(s.zapDomain(), s.curveAllow); err != nil {
+			log.Error().Err(err).Msg("failed to start curve auth")
+			panic(err)
+		}
+
+		soc.SetZapDomain(s.zapDomain())
+	}
+
+	soc.SetCurveServer(1)
+}
+
+// zapDomain is the ZAP domain of socket with an allowlist
+func (s *Sock) zapDomain() string {
+	return "nops-" + s.ID
+}
+
+// releaseCurve drops the allowlist of socket
+func (s *Sock) releaseCurve() {
+	if s.curveServer && len(s.curveAllow) > 0 {
+		zap.remove(s.zapDomain())
+	}
+}
@@ -0,0 +1,70 @@
+package sock
+
+import (
+	"fmt"
+	A "github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// savePublicCert saves the public key in ZeroMQ public cert format which can be loaded by zauth
+func savePublicCert(filename string, publicKey string) error {
+	content := fmt.Sprintf("metadata\ncurve\n    public-key = \"%s\"\n", publicKey)
+
+	return os.WriteFile(filename, []byte(content), 0600)
+}
+
+func TestLoadCurveCert(t *testing.T) {
+	assert := A.New(t)
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "server.key")
+
+	public := "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7"
+	secret := "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"
+
+	content := "#   ZeroMQ CURVE **Secret** Certificate\n\nmetadata\n    name = \"server\"\ncurve\n" +
+		"    public-key = \"" + public + "\"\n    secret-key = \"" + secret + "\"\n"
+	assert.Nil(os.WriteFile(filename+"_secret", []byte(content), 0600))
+	assert.Nil(savePublicCert(filename, public))
+
+	cert, err := LoadCurveCert(filename)
+	assert.Nil(err)
+	assert.Equal(cert.PublicKey, public)
+	assert.Equal(cert.SecretKey, secret)
+
+	assert.Nil(os.Remove(filename + "_secret"))
+	cert, err = LoadCurveCert(filename)
+	assert.Nil(err)
+	assert.Equal(cert.PublicKey, public)
+	assert.Equal(cert.SecretKey, "")
+
+	_, err = LoadCurveCert(filepath.Join(dir, "not-exist.key"))
+	assert.NotNil(err)
+}
+
+func TestZ85Encode(t *testing.T) {
+	assert := A.New(t)
+
+	assert.Equal(z85Encode([]byte{0x86, 0x4F, 0xD2, 0x6F, 0xB5, 0x59, 0xF7, 0x5B}), "HelloWorld")
+}
+
+func TestCurveAuthDomain(t *testing.T) {
+	assert := A.New(t)
+
+	a := &curveAuth{domains: make(map[string]map[string]struct{})}
+	a.domains["nops-a"] = map[string]struct{}{"rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7": {}}
+
+	assert.True(a.authorized("nops-a", "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7"))
+	assert.False(a.authorized("nops-a", "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"))
+
+	// allowlist of one socket never applies to others
+	assert.True(a.authorized("nops-b", "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"))
+	assert.True(a.authorized("", "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"))
+
+	a.remove("nops-a")
+	assert.True(a.authorized("nops-a", "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"))
+
+	assert.NotNil(a.allow("nops-a", []string{"short"}))
+}
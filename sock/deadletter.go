@@ -0,0 +1,169 @@
+package sock
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrExitWaitTimeout is the error of msg left in buffer when ExitWaitTimeout expires
+var ErrExitWaitTimeout = errors.New("exit wait timeout")
+
+// DeadMsg is a msg which failed to send for good
+type DeadMsg struct {
+	Msg    []byte
+	Err    error
+	Retry  uint8
+	SockID string
+	Time   time.Time
+}
+
+// DeadLetter receives msg which failed to send for good, Handle is called in the thread of socket and should not block
+type DeadLetter interface {
+	Handle(msg *DeadMsg)
+}
+
+// DeadLetterFunc is an adapter to use a func as DeadLetter
+type DeadLetterFunc func(msg *DeadMsg)
+
+// Handle calls f(msg)
+func (f DeadLetterFunc) Handle(msg *DeadMsg) {
+	f(msg)
+}
+
+// DeadLetterChan sends dead msg into channel, msg is dropped when channel is full
+type DeadLetterChan chan *DeadMsg
+
+// NewDeadLetterChan creates a DeadLetterChan with buffer size
+func NewDeadLetterChan(size int) DeadLetterChan {
+	return make(DeadLetterChan, size)
+}
+
+// Handle sends msg into channel without blocking
+func (c DeadLetterChan) Handle(msg *DeadMsg) {
+	select {
+	case c <- msg:
+	default:
+		log.Error().Str("id", msg.SockID).Bytes("data", msg.Msg).Msg("dead letter channel is full, drop msg")
+	}
+}
+
+// DeadLetterWriter writes dead msg into writer as json lines
+type DeadLetterWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type deadLetterRecord struct {
+	Msg    []byte    `json:"msg"`
+	Err    string    `json:"err"`
+	Retry  uint8     `json:"retry"`
+	SockID string    `json:"sock_id"`
+	Time   time.Time `json:"time"`
+}
+
+// NewDeadLetterWriter creates a DeadLetterWriter writing into w
+func NewDeadLetterWriter(w io.Writer) *DeadLetterWriter {
+	return &DeadLetterWriter{w: w}
+}
+
+// NewDeadLetterFile creates a DeadLetterWriter appending into file
+func NewDeadLetterFile(filename string) (*DeadLetterWriter, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDeadLetterWriter(f), nil
+}
+
+// Handle writes msg as one json line
+func (d *DeadLetterWriter) Handle(msg *DeadMsg) {
+	record := &deadLetterRecord{
+		Msg:    msg.Msg,
+		Retry:  msg.Retry,
+		SockID: msg.SockID,
+		Time:   msg.Time,
+	}
+
+	if msg.Err != nil {
+		record.Err = msg.Err.Error()
+	}
+
+	buf, err := json.Marshal(record)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal dead msg")
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := d.w.Write(append(buf, '\n')); err != nil {
+		log.Error().Err(err).Msg("failed to write dead msg")
+	}
+}
+
+// Close closes the writer when it is an io.Closer
+func (d *DeadLetterWriter) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if c, ok := d.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// WithDeadLetter sets the handler of msg which failed to send for good
+func WithDeadLetter(val DeadLetter) Option {
+	return func(s *Sock) {
+		s.deadLetter = val
+	}
+}
+
+// dead drops msg and passes it to dead letter handler
+func (s *Sock) dead(msg []byte, err error, retry uint8) {
+	if msgs, ok := s.unbatch(msg); ok {
+		for _, m := range msgs {
+			s.dead(m, err, retry)
+		}
+
+		return
+	}
+
+	s.dropMsgCount.Add(1)
+
+	if s.deadLetter == nil {
+		return
+	}
+
+	s.deadLetter.Handle(&DeadMsg{
+		Msg:    msg,
+		Err:    err,
+		Retry:  retry,
+		SockID: s.ID,
+		Time:   time.Now(),
+	})
+}
+
+// lost keeps msg into spool, msg goes to dead letter when spool is not enabled or failed to write
+func (s *Sock) lost(msg []byte, err error, retry uint8) {
+	if msgs, ok := s.unbatch(msg); ok {
+		for _, m := range msgs {
+			s.lost(m, err, retry)
+		}
+
+		return
+	}
+
+	if s.spoolMsg(msg) {
+		return
+	}
+
+	s.dead(msg, err, retry)
+}
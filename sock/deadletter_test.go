@@ -0,0 +1,115 @@
+package sock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	A "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDeadLetterChan(t *testing.T) {
+	assert := A.New(t)
+
+	ch := NewDeadLetterChan(1)
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://dead"),
+		WithDeadLetter(ch),
+	)
+
+	soc.dead([]byte("a"), fmt.Errorf("send failed"), 3)
+	soc.dead([]byte("b"), fmt.Errorf("send failed"), 3)
+
+	assert.Equal(soc.GetDropMsgCount(), uint64(2))
+	assert.Equal(len(ch), 1)
+
+	msg := <-ch
+	assert.Equal(msg.Msg, []byte("a"))
+	assert.Equal(msg.Err.Error(), "send failed")
+	assert.Equal(msg.Retry, uint8(3))
+	assert.Equal(msg.SockID, soc.GetID())
+}
+
+func TestDeadLetterWriter(t *testing.T) {
+	assert := A.New(t)
+
+	buf := &bytes.Buffer{}
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://dead"),
+		WithDeadLetter(NewDeadLetterWriter(buf)),
+	)
+
+	soc.dead([]byte("a"), ErrExitWaitTimeout, 0)
+
+	record := &deadLetterRecord{}
+	assert.Nil(json.Unmarshal(buf.Bytes(), record))
+	assert.Equal(record.Msg, []byte("a"))
+	assert.Equal(record.Err, ErrExitWaitTimeout.Error())
+	assert.Equal(record.SockID, soc.GetID())
+}
+
+func TestLostToSpool(t *testing.T) {
+	assert := A.New(t)
+
+	ch := NewDeadLetterChan(1)
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://dead"),
+		WithDeadLetter(ch),
+		WithSpool(t.TempDir()),
+	)
+
+	assert.Nil(soc.openSpool())
+	soc.lost([]byte("a"), ErrExitWaitTimeout, 0)
+
+	assert.Equal(len(ch), 0)
+	assert.Equal(soc.GetDropMsgCount(), uint64(0))
+	assert.Nil(soc.spool.Close())
+	assert.Equal(soc.spool.Len(), 1)
+}
+
+func TestDeadBatch(t *testing.T) {
+	assert := A.New(t)
+
+	ch := NewDeadLetterChan(2)
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://dead"),
+		WithDeadLetter(ch),
+		WithBatch(2, 0, 0),
+		WithCompression(CompressSnappy),
+	)
+
+	batch, err := NewBatch([][]byte{[]byte("a"), []byte("b")}, CompressSnappy)
+	assert.Nil(err)
+
+	// msg in a batch failed to send is handled one by one
+	soc.lost(batch, fmt.Errorf("send failed"), 3)
+
+	assert.Equal(soc.GetDropMsgCount(), uint64(2))
+	assert.Equal((<-ch).Msg, []byte("a"))
+	assert.Equal((<-ch).Msg, []byte("b"))
+}
+
+func TestDrainBufferWrap(t *testing.T) {
+	assert := A.New(t)
+
+	ch := NewDeadLetterChan(2)
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://dead"),
+		WithDeadLetter(ch),
+		WithEnvelope(),
+	)
+
+	soc.in <- []byte("a")
+	soc.drainBuffer()
+
+	// msg left in 'in' channel is dead lettered as it is on the wire
+	e, err := ParseEnvelope((<-ch).Msg)
+	assert.Nil(err)
+	assert.Equal(e.Body, []byte("a"))
+	assert.Equal(e.ProducerID, soc.GetID())
+}
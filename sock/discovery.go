@@ -0,0 +1,399 @@
+package sock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBeaconInterval = time.Second
+	DefaultBeaconTTL      = time.Second * 5
+
+	beaconMagic   = "NOPS"
+	beaconVersion = 1
+	maxBeaconSize = 4 + 1 + 1 + 255 + 1 + 255
+)
+
+// Beacon announces that service is served on endpoint
+type Beacon struct {
+	Service  string
+	Endpoint string
+}
+
+/*
+Bytes encodes beacon into one udp datagram
+
+	| 4 bytes magic 'NOPS' | 1 byte version | 1 byte service length | service | 1 byte endpoint length | endpoint |
+*/
+func (b Beacon) Bytes() []byte {
+	if len(b.Service) == 0 || len(b.Service) > 255 || len(b.Endpoint) == 0 || len(b.Endpoint) > 255 {
+		panic(fmt.Errorf("service and endpoint length must be in [1, 255], got %d and %d", len(b.Service), len(b.Endpoint)))
+	}
+
+	buf := make([]byte, 0, 4+1+1+len(b.Service)+1+len(b.Endpoint))
+	buf = append(buf, beaconMagic...)
+	buf = append(buf, beaconVersion)
+	buf = append(buf, byte(len(b.Service)))
+	buf = append(buf, b.Service...)
+	buf = append(buf, byte(len(b.Endpoint)))
+	buf = append(buf, b.Endpoint...)
+
+	return buf
+}
+
+// ParseBeacon decodes datagram created by Beacon.Bytes
+func ParseBeacon(buf []byte) (Beacon, error) {
+	if len(buf) < 6 || string(buf[:4]) != beaconMagic {
+		return Beacon{}, fmt.Errorf("malformed beacon: no beacon header")
+	}
+
+	if buf[4] != beaconVersion {
+		return Beacon{}, fmt.Errorf("malformed beacon: unsupported version %d", buf[4])
+	}
+
+	buf = buf[5:]
+
+	size := int(buf[0])
+	if size == 0 || len(buf) < 1+size+1 {
+		return Beacon{}, fmt.Errorf("malformed beacon: service exceeds buffer")
+	}
+
+	service := string(buf[1 : 1+size])
+	buf = buf[1+size:]
+
+	size = int(buf[0])
+	if size == 0 || len(buf) != 1+size {
+		return Beacon{}, fmt.Errorf("malformed beacon: endpoint length mismatch")
+	}
+
+	return Beacon{Service: service, Endpoint: string(buf[1:])}, nil
+}
+
+// BeaconHandler is called when a peer of service is discovered (alive is true) or its beacon expired
+type BeaconHandler func(b Beacon, alive bool)
+
+type watcher struct {
+	service string
+	handler BeaconHandler
+}
+
+/*
+Discovery broadcasts beacons of services announced and listens for beacons of peers on one udp port.
+
+	a peer is expired when no beacon is received in ttl. addr is the destination of beacons, e.g.
+	"255.255.255.255:31600" for the local network or "127.0.0.1:31600" on loopback, the same port is listened
+	with SO_REUSEADDR and SO_REUSEPORT on unix, so processes on one host share it. a unicast beacon is received by
+	one of them only, use the broadcast address when several processes of a host discover each other. the port
+	is not shared on other platforms.
+*/
+type Discovery struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	conn     *net.UDPConn
+	addr     *net.UDPAddr
+	interval time.Duration
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	announced map[Beacon]struct{}
+	peers     map[Beacon]time.Time
+	watchers  map[int]watcher
+	nextID    int
+}
+
+// NewDiscovery listens on the port of addr and starts broadcasting and expiring until Close or ctx done
+func NewDiscovery(ctx context.Context, addr string, interval, ttl time.Duration) (*Discovery, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if interval <= 0 {
+		interval = DefaultBeaconInterval
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultBeaconTTL
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := net.ListenConfig{Control: reusePort}
+
+	pc, err := lc.ListenPacket(ctx, "udp4", fmt.Sprintf(":%d", udpAddr.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	conn := pc.(*net.UDPConn)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	d := &Discovery{
+		ctx:       ctx,
+		cancel:    cancel,
+		conn:      conn,
+		addr:      udpAddr,
+		interval:  interval,
+		ttl:       ttl,
+		announced: make(map[Beacon]struct{}),
+		peers:     make(map[Beacon]time.Time),
+		watchers:  make(map[int]watcher),
+	}
+
+	Pool.CtxGo(ctx, d.listen)
+	Pool.CtxGo(ctx, d.broadcast)
+
+	return d, nil
+}
+
+// Announce broadcasts beacon of service on endpoint every interval until Withdraw, service and endpoint length
+// must be in [1, 255]
+func (d *Discovery) Announce(service, endpoint string) error {
+	if len(service) == 0 || len(service) > 255 || len(endpoint) == 0 || len(endpoint) > 255 {
+		return fmt.Errorf("service and endpoint length must be in [1, 255], got %d and %d", len(service), len(endpoint))
+	}
+
+	b := Beacon{Service: service, Endpoint: endpoint}
+
+	d.mu.Lock()
+	d.announced[b] = struct{}{}
+	d.mu.Unlock()
+
+	d.send(b)
+
+	return nil
+}
+
+// Withdraw stops broadcasting beacon of service on endpoint, peers expire it after ttl
+func (d *Discovery) Withdraw(service, endpoint string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.announced, Beacon{Service: service, Endpoint: endpoint})
+}
+
+// Peers gets the endpoints of service alive
+func (d *Discovery) Peers(service string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var endpoints []string
+	for b := range d.peers {
+		if b.Service == service {
+			endpoints = append(endpoints, b.Endpoint)
+		}
+	}
+
+	return endpoints
+}
+
+// Watch calls handler on every peer of service discovered or expired, peers alive are reported at once.
+// the returned func stops watching
+func (d *Discovery) Watch(service string, handler BeaconHandler) func() {
+	d.mu.Lock()
+	id := d.nextID
+	d.nextID++
+	d.watchers[id] = watcher{service: service, handler: handler}
+
+	var alive []Beacon
+	for b := range d.peers {
+		if b.Service == service {
+			alive = append(alive, b)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, b := range alive {
+		handler(b, true)
+	}
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		delete(d.watchers, id)
+	}
+}
+
+// Close stops broadcasting and listening
+func (d *Discovery) Close() error {
+	d.cancel()
+
+	if err := d.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// notify calls the handlers watching service of beacon
+func (d *Discovery) notify(b Beacon, alive bool) {
+	d.mu.Lock()
+	var handlers []BeaconHandler
+	for _, w := range d.watchers {
+		if w.service == b.Service {
+			handlers = append(handlers, w.handler)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(b, alive)
+	}
+}
+
+// send sends one beacon to the destination address
+func (d *Discovery) send(b Beacon) {
+	if _, err := d.conn.WriteToUDP(b.Bytes(), d.addr); err != nil && d.ctx.Err() == nil {
+		log.Error().Err(err).Str("service", b.Service).Msg("failed to send beacon")
+	}
+}
+
+// listen receives beacons until conn closed, a new peer is notified at once
+func (d *Discovery) listen() {
+	buf := make([]byte, maxBeaconSize)
+
+	for {
+		n, _, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || d.ctx.Err() != nil {
+				return
+			}
+
+			log.Error().Err(err).Msg("failed to receive beacon")
+			continue
+		}
+
+		b, err := ParseBeacon(buf[:n])
+		if err != nil {
+			log.Debug().Err(err).Msg("drop malformed beacon")
+			continue
+		}
+
+		d.mu.Lock()
+		_, ok := d.peers[b]
+		d.peers[b] = time.Now()
+		d.mu.Unlock()
+
+		if !ok {
+			log.Info().Str("service", b.Service).Str("endpoint", b.Endpoint).Msg("peer discovered")
+			d.notify(b, true)
+		}
+	}
+}
+
+// broadcast sends beacons announced and expires peers every interval
+func (d *Discovery) broadcast() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			// unblock listen
+			_ = d.conn.Close()
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		announced := make([]Beacon, 0, len(d.announced))
+		for b := range d.announced {
+			announced = append(announced, b)
+		}
+
+		var expired []Beacon
+		for b, seen := range d.peers {
+			if time.Since(seen) > d.ttl {
+				expired = append(expired, b)
+				delete(d.peers, b)
+			}
+		}
+		d.mu.Unlock()
+
+		for _, b := range announced {
+			d.send(b)
+		}
+
+		for _, b := range expired {
+			log.Info().Str("service", b.Service).Str("endpoint", b.Endpoint).Msg("peer expired")
+			d.notify(b, false)
+		}
+	}
+}
+
+// WithDiscovery makes socket connect to endpoints of service discovered and disconnect when they expire
+func WithDiscovery(d *Discovery, service string) Option {
+	return func(s *Sock) {
+		s.discovery = d
+		s.service = service
+	}
+}
+
+// watchDiscovery adds and removes the endpoints of service discovered at runtime
+func (s *Sock) watchDiscovery() {
+	if s.discovery == nil {
+		return
+	}
+
+	s.discovered = make(map[string]bool)
+	s.unwatch = s.discovery.Watch(s.service, func(b Beacon, alive bool) {
+		s.mu.Lock()
+		s.discovered[b.Endpoint] = alive
+		s.mu.Unlock()
+
+		// endpoints are changed in the thread of socket, a busy socket must not stall beacons of all services
+		Pool.CtxGo(s.ctx, s.syncDiscovered)
+	})
+}
+
+// syncDiscovered adds the endpoints discovered alive and removes the expired ones by the latest state, so changes
+// dispatched out of order end up the same
+func (s *Sock) syncDiscovered() {
+	s.syncing.Lock()
+	defer s.syncing.Unlock()
+
+	s.mu.Lock()
+	discovered := make(map[string]bool, len(s.discovered))
+	for addr, alive := range s.discovered {
+		discovered[addr] = alive
+	}
+	s.mu.Unlock()
+
+	for addr, alive := range discovered {
+		exists := false
+		for _, e := range s.GetEndpoints() {
+			if e.Addr == addr {
+				exists = true
+				break
+			}
+		}
+
+		var err error
+		switch {
+		case alive && !exists:
+			err = s.AddEndpoint(addr, true)
+		case !alive && exists:
+			err = s.RemoveEndpoint(addr)
+		}
+
+		if err != nil {
+			log.Debug().Err(err).Str("service", s.service).Str("endpoint", addr).Msg("skip endpoint discovered")
+		}
+
+		// expired endpoint is forgotten unless it is discovered again meanwhile
+		s.mu.Lock()
+		if val, ok := s.discovered[addr]; ok && !val && !alive {
+			delete(s.discovered, addr)
+		}
+		s.mu.Unlock()
+	}
+}
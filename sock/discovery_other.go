@@ -0,0 +1,12 @@
+//go:build !unix
+
+package sock
+
+import (
+	"syscall"
+)
+
+// reusePort leaves the udp socket as it is, the discovery port can not be shared by processes on this platform
+func reusePort(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
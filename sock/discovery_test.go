@@ -0,0 +1,109 @@
+package sock
+
+import (
+	"context"
+	A "github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBeacon(t *testing.T) {
+	assert := A.New(t)
+
+	b := Beacon{Service: "market", Endpoint: "tcp://127.0.0.1:31555"}
+
+	parsed, err := ParseBeacon(b.Bytes())
+	assert.Nil(err)
+	assert.Equal(parsed, b)
+
+	_, err = ParseBeacon([]byte("NOPS"))
+	assert.NotNil(err)
+
+	_, err = ParseBeacon(append(b.Bytes(), 'x'))
+	assert.NotNil(err)
+
+	buf := b.Bytes()
+	buf[4] = beaconVersion + 1
+	_, err = ParseBeacon(buf)
+	assert.NotNil(err)
+
+	assert.Panics(func() {
+		_ = Beacon{Service: "market"}.Bytes()
+	})
+}
+
+func TestDiscovery(t *testing.T) {
+	assert := A.New(t)
+
+	d, err := NewDiscovery(context.Background(), "127.0.0.1:31600", time.Millisecond*50, time.Millisecond*300)
+	assert.Nil(err)
+	defer d.Close()
+
+	var mu sync.Mutex
+	events := make(map[string]bool)
+
+	stop := d.Watch("market", func(b Beacon, alive bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events[b.Endpoint] = alive
+	})
+
+	sub := New(WithType("SUB"), WithDiscovery(d, "market"))
+
+	assert.Nil(d.Announce("market", "tcp://127.0.0.1:31601"))
+	assert.Nil(d.Announce("other", "tcp://127.0.0.1:31602"))
+	assert.NotNil(d.Announce("", "tcp://127.0.0.1:31602"))
+	assert.NotNil(d.Announce("market", string(make([]byte, 256))))
+
+	// the port is shared with another discovery on the same host
+	shared, err := NewDiscovery(context.Background(), "127.0.0.1:31600", time.Millisecond*50, time.Millisecond*300)
+	assert.Nil(err)
+	assert.Nil(shared.Close())
+
+	time.Sleep(time.Millisecond * 200)
+
+	assert.Equal(d.Peers("market"), []string{"tcp://127.0.0.1:31601"})
+	assert.Equal(sub.GetEndpoints(), []EndpointSpec{{Addr: "tcp://127.0.0.1:31601", Connect: true}})
+
+	mu.Lock()
+	assert.Equal(events, map[string]bool{"tcp://127.0.0.1:31601": true})
+	mu.Unlock()
+
+	d.Withdraw("market", "tcp://127.0.0.1:31601")
+
+	time.Sleep(time.Millisecond * 600)
+
+	assert.Equal(len(d.Peers("market")), 0)
+	assert.Equal(len(d.Peers("other")), 1)
+	assert.Equal(len(sub.GetEndpoints()), 0)
+
+	mu.Lock()
+	assert.Equal(events, map[string]bool{"tcp://127.0.0.1:31601": false})
+	mu.Unlock()
+
+	stop()
+	sub.release()
+}
+
+func TestSyncDiscovered(t *testing.T) {
+	assert := A.New(t)
+
+	s := New(WithType("Pull"), WithBind("inproc://discovered"))
+	s.discovered = map[string]bool{"tcp://127.0.0.1:31605": true, "tcp://127.0.0.1:31606": false}
+
+	s.syncDiscovered()
+	assert.Equal(s.GetEndpoints(), []EndpointSpec{
+		{Addr: "inproc://discovered"},
+		{Addr: "tcp://127.0.0.1:31605", Connect: true},
+	})
+	assert.Equal(s.discovered, map[string]bool{"tcp://127.0.0.1:31605": true})
+
+	// the latest state is applied, expired endpoint is forgotten
+	s.discovered["tcp://127.0.0.1:31605"] = false
+	s.syncDiscovered()
+	s.syncDiscovered()
+	assert.Equal(s.GetEndpoints(), []EndpointSpec{{Addr: "inproc://discovered"}})
+	assert.Empty(s.discovered)
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package sock
+
+import (
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+// reusePort sets SO_REUSEADDR and SO_REUSEPORT on the udp socket before it is bound
+func reusePort(_, _ string, c syscall.RawConn) error {
+	var err error
+	if ctlErr := c.Control(func(fd uintptr) {
+		if err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+			return
+		}
+
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); ctlErr != nil {
+		return ctlErr
+	}
+
+	return err
+}
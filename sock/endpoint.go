@@ -0,0 +1,277 @@
+package sock
+
+import (
+	"fmt"
+	"github.com/zeromq/goczmq"
+	"strings"
+)
+
+// EndpointSpec is one endpoint of socket, it is bound on local or connected to remote
+type EndpointSpec struct {
+	Addr    string
+	Connect bool
+}
+
+func (e EndpointSpec) String() string {
+	if e.Connect {
+		return "connect " + e.Addr
+	}
+
+	return "bind " + e.Addr
+}
+
+// WithBind adds endpoints bound by socket, it can be mixed with WithConnect
+func WithBind(addrs ...string) Option {
+	return func(s *Sock) {
+		for _, addr := range addrs {
+			s.endpoints = append(s.endpoints, EndpointSpec{Addr: addr})
+		}
+	}
+}
+
+// WithConnect adds endpoints connected by socket, it can be mixed with WithBind
+func WithConnect(addrs ...string) Option {
+	return func(s *Sock) {
+		for _, addr := range addrs {
+			s.endpoints = append(s.endpoints, EndpointSpec{Addr: addr, Connect: true})
+		}
+	}
+}
+
+// initEndpoints merges WithEndpoint/WithAttach into the endpoint list, Endpoint is the first endpoint
+func (s *Sock) initEndpoints() {
+	if s.Endpoint != "" {
+		found := false
+		for _, e := range s.endpoints {
+			if e.Addr == s.Endpoint {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			s.endpoints = append([]EndpointSpec{{Addr: s.Endpoint, Connect: s.attach}}, s.endpoints...)
+		}
+	}
+
+	if s.Endpoint == "" && len(s.endpoints) > 0 {
+		s.Endpoint = s.endpoints[0].Addr
+	}
+
+	s.attached = make(map[string]EndpointSpec)
+}
+
+// GetEndpoints gets all endpoints of socket
+func (s *Sock) GetEndpoints() []EndpointSpec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]EndpointSpec{}, s.endpoints...)
+}
+
+// endpointAddrs gets the addr of all endpoints joined by comma in order
+func (s *Sock) endpointAddrs() string {
+	endpoints := s.GetEndpoints()
+
+	addrs := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		addrs = append(addrs, e.Addr)
+	}
+
+	return strings.Join(addrs, ",")
+}
+
+// AddEndpoint binds or connects a new endpoint, it takes effect at runtime. when the run loop is running, it waits
+// until endpoint is attached in the thread of socket and returns the error of bind or connect, endpoint failed is
+// not added
+func (s *Sock) AddEndpoint(addr string, connect bool) error {
+	if addr == "" {
+		return fmt.Errorf("empty endpoint")
+	}
+
+	e := EndpointSpec{Addr: addr, Connect: connect}
+
+	s.mu.Lock()
+	for _, v := range s.endpoints {
+		if v.Addr == addr {
+			s.mu.Unlock()
+			return fmt.Errorf("endpoint %s already exists", addr)
+		}
+	}
+
+	// endpoint list is read by Attach when the run loop is not running yet
+	s.endpoints = append(s.endpoints, e)
+	live := s.live
+	s.mu.Unlock()
+
+	if !live {
+		return nil
+	}
+
+	err := s.call(s.ctx, func(soc *goczmq.Sock) error {
+		return s.attachEndpoint(soc, e)
+	})
+
+	if err != nil {
+		s.mu.Lock()
+		s.endpoints = removeEndpoint(s.endpoints, addr)
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+// RemoveEndpoint unbinds or disconnects an endpoint, it takes effect at runtime. when the run loop is running, it
+// waits until endpoint is detached in the thread of socket and returns the error of unbind or disconnect
+func (s *Sock) RemoveEndpoint(addr string) error {
+	s.mu.Lock()
+	found := false
+	for _, e := range s.endpoints {
+		if e.Addr == addr {
+			found = true
+			break
+		}
+	}
+
+	s.endpoints = removeEndpoint(s.endpoints, addr)
+	live := s.live
+	s.mu.Unlock()
+
+	if !found {
+		return fmt.Errorf("endpoint %s not found", addr)
+	}
+
+	if !live {
+		return nil
+	}
+
+	return s.call(s.ctx, func(soc *goczmq.Sock) error {
+		return s.detachEndpoint(soc, addr)
+	})
+}
+
+// removeEndpoint removes endpoint by addr from list
+func removeEndpoint(endpoints []EndpointSpec, addr string) []EndpointSpec {
+	for i, e := range endpoints {
+		if e.Addr == addr {
+			return append(endpoints[:i], endpoints[i+1:]...)
+		}
+	}
+
+	return endpoints
+}
+
+// attachEndpoint binds or connects endpoint when it is not attached yet
+func (s *Sock) attachEndpoint(soc *goczmq.Sock, e EndpointSpec) error {
+	if soc == nil {
+		return fmt.Errorf("sock pointer is nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.attached[e.Addr]; ok {
+		return nil
+	}
+
+	return s.bindOrConnect(soc, e)
+}
+
+// detachEndpoint unbinds or disconnects endpoint when it is attached
+func (s *Sock) detachEndpoint(soc *goczmq.Sock, addr string) error {
+	if soc == nil {
+		return fmt.Errorf("sock pointer is nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.attached[addr]
+	if !ok {
+		return nil
+	}
+
+	return s.unbindOrDisconnect(soc, e)
+}
+
+// attachEndpoints makes the endpoints of socket equal to endpoint list, only the difference is applied.
+// error of the first endpoint failed is returned, the others are still tried
+func (s *Sock) attachEndpoints(soc *goczmq.Sock) error {
+	if soc == nil {
+		return fmt.Errorf("sock pointer is nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := make(map[string]EndpointSpec, len(s.endpoints))
+	for _, e := range s.endpoints {
+		want[e.Addr] = e
+	}
+
+	var first error
+
+	for addr, e := range s.attached {
+		if _, ok := want[addr]; ok {
+			continue
+		}
+
+		if err := s.unbindOrDisconnect(soc, e); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	// keep the order of endpoint list
+	for _, e := range s.endpoints {
+		if _, ok := s.attached[e.Addr]; ok {
+			continue
+		}
+
+		if err := s.bindOrConnect(soc, e); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// bindOrConnect attaches endpoint, s.mu must be held
+func (s *Sock) bindOrConnect(soc *goczmq.Sock, e EndpointSpec) error {
+	var err error
+	if e.Connect {
+		err = soc.Connect(e.Addr)
+	} else {
+		_, err = soc.Bind(e.Addr)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("endpoint", e.String()).Msg("failed to attach endpoint")
+		return err
+	}
+
+	log.Debug().Str("endpoint", e.String()).Msg("attach endpoint")
+	s.attached[e.Addr] = e
+
+	return nil
+}
+
+// unbindOrDisconnect detaches endpoint, it is not attached any more even on error. s.mu must be held
+func (s *Sock) unbindOrDisconnect(soc *goczmq.Sock, e EndpointSpec) error {
+	delete(s.attached, e.Addr)
+
+	var err error
+	if e.Connect {
+		err = soc.Disconnect(e.Addr)
+	} else {
+		err = soc.Unbind(e.Addr)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("endpoint", e.String()).Msg("failed to detach endpoint")
+		return err
+	}
+
+	log.Debug().Str("endpoint", e.String()).Msg("detach endpoint")
+
+	return nil
+}
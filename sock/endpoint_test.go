@@ -0,0 +1,39 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEndpoints(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("SUB"),
+		WithBind("ipc:///tmp/nops-endpoint"),
+		WithConnect("tcp://127.0.0.1:31559", "tcp://127.0.0.1:31560"),
+	)
+
+	assert.Equal(soc.Endpoint, "ipc:///tmp/nops-endpoint")
+	assert.Equal(soc.GetEndpoints(), []EndpointSpec{
+		{Addr: "ipc:///tmp/nops-endpoint"},
+		{Addr: "tcp://127.0.0.1:31559", Connect: true},
+		{Addr: "tcp://127.0.0.1:31560", Connect: true},
+	})
+
+	assert.Nil(soc.AddEndpoint("tcp://127.0.0.1:31561", true))
+	assert.NotNil(soc.AddEndpoint("tcp://127.0.0.1:31561", true))
+	assert.NotNil(soc.AddEndpoint("", true))
+	assert.Equal(len(soc.GetEndpoints()), 4)
+
+	assert.Nil(soc.RemoveEndpoint("tcp://127.0.0.1:31559"))
+	assert.NotNil(soc.RemoveEndpoint("tcp://127.0.0.1:31559"))
+	assert.Equal(len(soc.GetEndpoints()), 3)
+
+	soc = New(WithType("PUSH"), WithEndpoint("inproc://endpoint"), WithAttach(), WithBind("inproc://local"))
+	assert.Equal(soc.GetEndpoints(), []EndpointSpec{
+		{Addr: "inproc://endpoint", Connect: true},
+		{Addr: "inproc://local"},
+	})
+	assert.Equal(EndpointSpec{Addr: "inproc://local"}.String(), "bind inproc://local")
+}
@@ -0,0 +1,280 @@
+package sock
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/lafrinte/nops/str"
+	"github.com/rs/xid"
+	"github.com/zeromq/goczmq"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	EnvelopeVersion = 1
+
+	envelopeMagic0 = 'N'
+	envelopeMagic1 = 'E'
+	// magic + version + id + correlation id + timestamp + schema version + producer id length + header count
+	envelopeFixedSize = 2 + 1 + 12 + 12 + 8 + 2 + 1 + 1
+)
+
+/*
+Envelope is the standard header of sock msg, it is prefixed to the msg body in binary
+
+	| 2 bytes magic 'NE' | 1 byte envelope version | 12 bytes id | 12 bytes correlation id |
+	| 8 bytes timestamp in unix nano | 2 bytes schema version | 1 byte producer id length | producer id |
+	| 1 byte header count | { 1 byte key length | key | uvarint value length | value } ... | body |
+
+all integers are big endian. on a multipart socket the envelope is applied to the last frame.
+*/
+type Envelope struct {
+	// ID is the uniq id of msg generated by str.ID, it is kept on retry
+	ID xid.ID
+	// CorrelationID is the ID of request msg on reply, or zero
+	CorrelationID xid.ID
+	ProducerID    string
+	Timestamp     time.Time
+	SchemaVersion uint16
+	Headers       map[string]string
+	Body          []byte
+}
+
+// NewEnvelope creates an Envelope with a new ID and current timestamp
+func NewEnvelope(body []byte) *Envelope {
+	return &Envelope{
+		ID:        str.ID(),
+		Timestamp: time.Now(),
+		Body:      body,
+	}
+}
+
+// Bytes encodes the envelope header and body into one buffer
+func (e *Envelope) Bytes() []byte {
+	if len(e.ProducerID) > 255 {
+		panic(fmt.Errorf("producer id length must be in [0, 255], got %d", len(e.ProducerID)))
+	}
+
+	if len(e.Headers) > 255 {
+		panic(fmt.Errorf("header count must be in [0, 255], got %d", len(e.Headers)))
+	}
+
+	buf := make([]byte, 0, envelopeFixedSize+len(e.ProducerID)+len(e.Body))
+	buf = append(buf, envelopeMagic0, envelopeMagic1, EnvelopeVersion)
+	buf = append(buf, e.ID.Bytes()...)
+	buf = append(buf, e.CorrelationID.Bytes()...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.Timestamp.UnixNano()))
+	buf = binary.BigEndian.AppendUint16(buf, e.SchemaVersion)
+	buf = append(buf, byte(len(e.ProducerID)))
+	buf = append(buf, e.ProducerID...)
+
+	// sort keys, so the same envelope is always encoded into the same bytes
+	keys := make([]string, 0, len(e.Headers))
+	for key := range e.Headers {
+		if len(key) > 255 {
+			panic(fmt.Errorf("header key length must be in [0, 255], got %d", len(key)))
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	buf = append(buf, byte(len(keys)))
+	for _, key := range keys {
+		buf = append(buf, byte(len(key)))
+		buf = append(buf, key...)
+		buf = binary.AppendUvarint(buf, uint64(len(e.Headers[key])))
+		buf = append(buf, e.Headers[key]...)
+	}
+
+	return append(buf, e.Body...)
+}
+
+// IsEnvelope reports whether buf starts with the envelope magic
+func IsEnvelope(buf []byte) bool {
+	return len(buf) >= 3 && buf[0] == envelopeMagic0 && buf[1] == envelopeMagic1
+}
+
+// ParseEnvelope decodes buffer created by Envelope.Bytes
+func ParseEnvelope(buf []byte) (*Envelope, error) {
+	if len(buf) < envelopeFixedSize || !IsEnvelope(buf) {
+		return nil, fmt.Errorf("malformed envelope: no envelope header")
+	}
+
+	if buf[2] != EnvelopeVersion {
+		return nil, fmt.Errorf("malformed envelope: unsupported version %d", buf[2])
+	}
+
+	e := &Envelope{}
+	buf = buf[3:]
+
+	var err error
+	if e.ID, err = xid.FromBytes(buf[:12]); err != nil {
+		return nil, fmt.Errorf("malformed envelope: %w", err)
+	}
+
+	if e.CorrelationID, err = xid.FromBytes(buf[12:24]); err != nil {
+		return nil, fmt.Errorf("malformed envelope: %w", err)
+	}
+
+	e.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(buf[24:32])))
+	e.SchemaVersion = binary.BigEndian.Uint16(buf[32:34])
+
+	size := int(buf[34])
+	buf = buf[35:]
+	if len(buf) < size+1 {
+		return nil, fmt.Errorf("malformed envelope: producer id exceeds buffer")
+	}
+
+	e.ProducerID = string(buf[:size])
+	buf = buf[size:]
+
+	count := int(buf[0])
+	buf = buf[1:]
+
+	if count > 0 {
+		e.Headers = make(map[string]string, count)
+	}
+
+	for i := 0; i < count; i++ {
+		if len(buf) < 1 || len(buf) < 1+int(buf[0]) {
+			return nil, fmt.Errorf("malformed envelope: header key %d exceeds buffer", i)
+		}
+
+		key := string(buf[1 : 1+int(buf[0])])
+		buf = buf[1+int(buf[0]):]
+
+		length, n := binary.Uvarint(buf)
+		if n <= 0 || length > uint64(len(buf)-n) {
+			return nil, fmt.Errorf("malformed envelope: header value %d exceeds buffer", i)
+		}
+
+		e.Headers[key] = string(buf[n : n+int(length)])
+		buf = buf[n+int(length):]
+	}
+
+	e.Body = buf
+
+	return e, nil
+}
+
+/*
+WithEnvelope makes socket prefix an Envelope on every msg it sends, and parse the Envelope of every msg it
+receives. msg without a valid Envelope is dropped on receiving.
+
+	msg received is put into 'out' channel raw with its Envelope, as Recv and Request return it, so it can be
+	passed to Ack. RecvEnvelope or Unwrap gets the Envelope and its Body. msg put into 'in' channel is the body
+	only, Responser wraps reply with the ID of request as CorrelationID
+*/
+func WithEnvelope() Option {
+	return func(s *Sock) {
+		s.envelope = true
+	}
+}
+
+// WithProducerID sets the ProducerID of Envelope, the ID of Sock is used by default
+func WithProducerID(val string) Option {
+	return func(s *Sock) {
+		s.producerID = val
+	}
+}
+
+// WithSchemaVersion sets the SchemaVersion of Envelope
+func WithSchemaVersion(val uint16) Option {
+	return func(s *Sock) {
+		s.schemaVersion = val
+	}
+}
+
+// newEnvelope creates an Envelope of socket
+func (s *Sock) newEnvelope(body []byte, correlation xid.ID) *Envelope {
+	e := NewEnvelope(body)
+	e.CorrelationID = correlation
+	e.ProducerID = s.producerID
+	e.SchemaVersion = s.schemaVersion
+
+	if s.sequence {
+		e.Headers = map[string]string{
+			SequenceHeader:      strconv.FormatUint(s.seq.Add(1), 10),
+			SequenceEpochHeader: strconv.FormatUint(s.epoch, 10),
+		}
+	}
+
+	return e
+}
+
+// wrap prefixes an Envelope to the body of msg before it is sent or retried, correlation is the ID of request on reply
+func (s *Sock) wrap(msg []byte, correlation xid.ID) []byte {
+	if !s.envelope {
+		return msg
+	}
+
+	if s.multipart {
+		m, err := ParseMessage(msg)
+		if err != nil || len(m) == 0 {
+			// sendFrame reports malformed message
+			return msg
+		}
+
+		m[len(m)-1] = s.newEnvelope(m[len(m)-1], correlation).Bytes()
+
+		return m.Bytes()
+	}
+
+	if s.Type == goczmq.Router {
+		identity, body, err := SplitRouteMsg(msg)
+		if err != nil {
+			return msg
+		}
+
+		return NewRouteMsg(identity, s.newEnvelope(body, correlation).Bytes())
+	}
+
+	return s.newEnvelope(msg, correlation).Bytes()
+}
+
+// unwrap parses the Envelope of msg received
+func (s *Sock) unwrap(msg []byte) (*Envelope, error) {
+	body := msg
+
+	if s.multipart {
+		m, err := ParseMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(m) == 0 {
+			return nil, fmt.Errorf("empty message")
+		}
+
+		body = m[len(m)-1]
+	} else if s.Type == goczmq.Router {
+		_, b, err := SplitRouteMsg(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		body = b
+	}
+
+	return ParseEnvelope(body)
+}
+
+// Unwrap parses the Envelope of raw msg taken from 'out' channel, the route msg of ROUTER and the Message of
+// multipart socket are handled. socket must be created with WithEnvelope
+func (s *Sock) Unwrap(msg []byte) (*Envelope, error) {
+	return s.unwrap(msg)
+}
+
+// RecvEnvelope receives one msg from 'out' channel and parses its Envelope, socket must be created with WithEnvelope
+func (s *Sock) RecvEnvelope(ctx context.Context) (*Envelope, error) {
+	msg, err := s.Recv(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Unwrap(msg)
+}
@@ -0,0 +1,91 @@
+package sock
+
+import (
+	"github.com/rs/xid"
+	A "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	assert := A.New(t)
+
+	e := NewEnvelope([]byte("body"))
+	e.CorrelationID = xid.New()
+	e.ProducerID = "producer"
+	e.SchemaVersion = 2
+	e.Headers = map[string]string{"trace": "abc", "empty": ""}
+
+	parsed, err := ParseEnvelope(e.Bytes())
+	assert.Nil(err)
+	assert.Equal(parsed.ID, e.ID)
+	assert.Equal(parsed.CorrelationID, e.CorrelationID)
+	assert.Equal(parsed.ProducerID, "producer")
+	assert.Equal(parsed.SchemaVersion, uint16(2))
+	assert.Equal(parsed.Timestamp.UnixNano(), e.Timestamp.UnixNano())
+	assert.Equal(parsed.Headers, e.Headers)
+	assert.Equal(parsed.Body, []byte("body"))
+	assert.Equal(e.Bytes(), e.Bytes())
+
+	parsed, err = ParseEnvelope(NewEnvelope(nil).Bytes())
+	assert.Nil(err)
+	assert.True(parsed.CorrelationID.IsNil())
+	assert.Equal(len(parsed.Body), 0)
+
+	_, err = ParseEnvelope([]byte("body"))
+	assert.NotNil(err)
+
+	buf := e.Bytes()
+	_, err = ParseEnvelope(buf[:envelopeFixedSize+5])
+	assert.NotNil(err)
+
+	buf[2] = EnvelopeVersion + 1
+	_, err = ParseEnvelope(buf)
+	assert.NotNil(err)
+}
+
+func TestWrapEnvelope(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(WithType("PUSH"), WithEndpoint("inproc://envelope"), WithEnvelope(), WithSchemaVersion(3))
+	// every wrap creates a new msg ID
+	assert.NotEqual(soc.wrap([]byte("body"), xid.NilID()), soc.wrap([]byte("body"), xid.NilID()))
+
+	correlation := xid.New()
+	e, err := soc.unwrap(soc.wrap([]byte("body"), correlation))
+	assert.Nil(err)
+	assert.Equal(e.ProducerID, soc.ID)
+	assert.Equal(e.SchemaVersion, uint16(3))
+	assert.Equal(e.CorrelationID, correlation)
+	assert.Equal(e.Body, []byte("body"))
+
+	soc = New(WithType("PUSH"), WithEndpoint("inproc://envelope"), WithEnvelope(), WithMultipart(), WithProducerID("p"))
+	m, err := ParseMessage(soc.wrap(NewMessage([]byte("header"), []byte("body")).Bytes(), xid.NilID()))
+	assert.Nil(err)
+	assert.Equal(m[0], []byte("header"))
+
+	e, err = soc.unwrap(m.Bytes())
+	assert.Nil(err)
+	assert.Equal(e.ProducerID, "p")
+	assert.Equal(e.Body, []byte("body"))
+
+	soc = New(WithType("PUSH"), WithEndpoint("inproc://envelope"))
+	assert.Equal(soc.wrap([]byte("body"), xid.NilID()), []byte("body"))
+}
+
+func TestUnwrap(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(WithType("Router"), WithEndpoint("inproc://envelope"), WithEnvelope())
+
+	msg := soc.wrap(NewRouteMsg([]byte("peer"), []byte("body")), xid.NilID())
+	identity, _, err := SplitRouteMsg(msg)
+	assert.Nil(err)
+	assert.Equal(identity, []byte("peer"))
+
+	e, err := soc.Unwrap(msg)
+	assert.Nil(err)
+	assert.Equal(e.Body, []byte("body"))
+
+	_, err = soc.Unwrap(NewRouteMsg([]byte("peer"), []byte("body")))
+	assert.NotNil(err)
+}
@@ -0,0 +1,61 @@
+package sock
+
+import "github.com/zeromq/goczmq"
+
+/*
+Fault injects failures into the io of socket, it is used by package socktest to test retry and recovery.
+
+	Send is called before frames are sent, the send fails with the error returned.
+	Recv is called after frames are received, the msg is dropped with the error returned.
+
+both may sleep to simulate latency, or panic to simulate a crash of the run loop.
+*/
+type Fault interface {
+	Send(frames [][]byte) error
+	Recv(frames [][]byte) error
+}
+
+// WithFault injects fault into socket
+func WithFault(f Fault) Option {
+	return func(s *Sock) {
+		s.fault = f
+	}
+}
+
+// send sends frames as one message with the fault injected, and measures the send rate
+func (s *Sock) send(sock *goczmq.Sock, frames [][]byte) error {
+	if s.fault != nil {
+		if err := s.fault.Send(frames); err != nil {
+			return err
+		}
+	}
+
+	if err := sendFrames(sock, frames); err != nil {
+		return err
+	}
+
+	size := 0
+	for _, frame := range frames {
+		size += len(frame)
+	}
+
+	s.sendRate.mark(size)
+
+	return nil
+}
+
+// recv receives all frames of one message with the fault injected
+func (s *Sock) recv(sock *goczmq.Sock) ([][]byte, error) {
+	frames, err := sock.RecvMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.fault != nil {
+		if err := s.fault.Recv(frames); err != nil {
+			return nil, err
+		}
+	}
+
+	return frames, nil
+}
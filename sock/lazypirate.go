@@ -0,0 +1,199 @@
+package sock
+
+import (
+	"context"
+	"fmt"
+	"github.com/lafrinte/nops/timer"
+	"github.com/rs/xid"
+	"github.com/zeromq/goczmq"
+	"sync"
+	"time"
+)
+
+/*
+LazyPirate is a reliable request/reply client following the Lazy Pirate pattern of zeromq guide.
+
+	a request waits RecvTimeoutSec for its reply, on timeout the REQ socket is closed and reopened on the next
+	endpoint, the request is resent after ReconnectIvlMillSec. the request is given up after RetryAttempts retries
+
+all options of Sock are reused, socket type is always REQ and endpoints are connected.
+*/
+type LazyPirate struct {
+	mu        sync.Mutex
+	s         *Sock
+	endpoints []string
+	current   int
+	poller    *goczmq.Poller
+}
+
+// NewLazyPirate creates a LazyPirate which fails over across endpoints
+func NewLazyPirate(endpoints []string, opts ...Option) *LazyPirate {
+	if len(endpoints) == 0 {
+		panic(fmt.Errorf("lazy pirate needs one endpoint at least"))
+	}
+
+	opts = append(opts, WithType("REQ"), WithEndpoint(endpoints[0]), WithAttach())
+
+	return &LazyPirate{
+		s:         New(opts...),
+		endpoints: endpoints,
+	}
+}
+
+// GetSock gets the Sock holding options and counters of client
+func (c *LazyPirate) GetSock() *Sock {
+	return c.s
+}
+
+// GetEndpoint gets the endpoint in use
+func (c *LazyPirate) GetEndpoint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.endpoints[c.current]
+}
+
+// open connects REQ socket to current endpoint when it is not open
+func (c *LazyPirate) open() error {
+	if c.s.soc != nil {
+		return nil
+	}
+
+	c.s.Endpoint = c.endpoints[c.current]
+
+	soc, err := c.s.connect()
+	if err != nil {
+		// setOptions has created the socket before connect failed
+		if c.s.soc != nil {
+			c.s.soc.Destroy()
+			c.s.soc = nil
+		}
+
+		return err
+	}
+
+	poller, err := goczmq.NewPoller(soc)
+	if err != nil {
+		soc.Destroy()
+		c.s.soc = nil
+
+		return err
+	}
+
+	c.poller = poller
+
+	return nil
+}
+
+// reset closes REQ socket which can not be reused after a lost reply, and moves to the next endpoint
+func (c *LazyPirate) reset() {
+	if c.poller != nil {
+		c.poller.Destroy()
+		c.poller = nil
+	}
+
+	if c.s.soc != nil {
+		// drop the pending request at once
+		c.s.soc.SetLinger(0)
+		c.s.soc.Destroy()
+		c.s.soc = nil
+	}
+
+	c.current = (c.current + 1) % len(c.endpoints)
+}
+
+// wait polls REQ socket until a reply is readable, timeout or ctx done
+func (c *LazyPirate) wait(ctx context.Context, timeout time.Duration) (bool, error) {
+	return poll(ctx, c.poller, timeout)
+}
+
+// sleep waits the reconnect interval before the next retry
+func (c *LazyPirate) sleep(ctx context.Context) error {
+	t := timer.AcquireTimer(time.Duration(c.s.ReconnectIvlMillSec) * time.Millisecond)
+	defer timer.ReleaseTimer(t)
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctxErr(ctx)
+	}
+}
+
+// Request sends request msg and waits for its reply, retries on the next endpoint when no reply. ErrNoReply is
+// returned when all retries failed
+func (c *LazyPirate) Request(ctx context.Context, msg []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.s.IsClosed() {
+		return nil, ErrClosed
+	}
+
+	// the envelope is created once, so retries keep the same msg ID
+	frames, err := c.s.frames(c.s.wrap(msg, xid.NilID()))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(c.s.RecvTimeoutSec) * time.Second
+
+	for attempt := 0; attempt <= int(c.s.RetryAttempts); attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := c.open(); err != nil {
+			log.Error().Err(err).Str("endpoint", c.endpoints[c.current]).Msg("lazy pirate failed to connect")
+			c.reset()
+			continue
+		}
+
+		if err := c.s.send(c.s.soc, frames); err != nil {
+			log.Error().Err(err).Str("endpoint", c.s.Endpoint).Msg("lazy pirate failed to send")
+			c.reset()
+			continue
+		}
+
+		c.s.sendMsgCount.Add(1)
+
+		ok, err := c.wait(ctx, timeout)
+		if err != nil {
+			// the reply of this request must not be read by the next one
+			c.reset()
+			return nil, err
+		}
+
+		if ok {
+			reply, err := c.s.recvMsg(c.s.soc)
+			if err == nil {
+				c.s.recvMsgCount.Add(1)
+				return reply, nil
+			}
+
+			log.Error().Err(err).Str("endpoint", c.s.Endpoint).Msg("lazy pirate failed to receive")
+		}
+
+		log.Warn().Str("endpoint", c.s.Endpoint).Msgf("lazy pirate get no reply, retry the %d time", attempt+1)
+		c.reset()
+	}
+
+	c.s.dropMsgCount.Add(1)
+
+	return nil, ErrNoReply
+}
+
+// Close closes the REQ socket, Request returns ErrClosed after Close
+func (c *LazyPirate) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.poller != nil {
+		c.poller.Destroy()
+		c.poller = nil
+	}
+
+	c.s.release()
+}
@@ -0,0 +1,322 @@
+package sock
+
+import (
+	"context"
+	"fmt"
+	"github.com/zeromq/goczmq"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultShutdownDeadline = time.Second * 30
+	DefaultFlapWindow       = time.Minute
+	DefaultFlapThreshold    = 5
+)
+
+const (
+	StateCreated = "created"
+	StateRunning = "running"
+	StateStopped = "stopped"
+)
+
+// SockStatus is the status and counters of a Sock managed by Manager
+type SockStatus struct {
+	Name     string
+	ID       string
+	Type     string
+	Endpoint string // addr of all endpoints joined by comma
+	State    string
+	In       int
+	Out      int
+	Retry    int
+	Send     uint64
+	Recv     uint64
+	Drop     uint64
+	Restarts int
+	Flapping bool
+}
+
+type managed struct {
+	name     string
+	s        *Sock
+	cancel   context.CancelFunc
+	started  bool
+	restarts []time.Time
+	total    int
+}
+
+/*
+Manager creates sockets by name, starts their run loop together and stops them in order.
+
+	sockets are stopped in the reverse order of creation within the global deadline, so the socket created
+	first (e.g. the consumer feeding the others) is released last. a socket restarted by recovery at least
+	DefaultFlapThreshold times in DefaultFlapWindow is reported as flapping. sockets are created with
+	WithAutoRestart, DisableRestart in opts overrides it.
+*/
+type Manager struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	deadline time.Duration
+	socks    map[string]*managed
+	order    []string
+}
+
+// NewManager creates a Manager, all sockets are stopped when ctx is done. deadline is the global deadline of Stop
+func NewManager(ctx context.Context, deadline time.Duration) *Manager {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if deadline <= 0 {
+		deadline = DefaultShutdownDeadline
+	}
+
+	return &Manager{
+		ctx:      ctx,
+		deadline: deadline,
+		socks:    make(map[string]*managed),
+	}
+}
+
+// Create creates a Sock by New with opts and registers it by name, WithCtx in opts is overridden by Manager
+func (m *Manager) Create(name string, opts ...Option) (*Sock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.socks[name]; ok {
+		return nil, fmt.Errorf("sock %s already exists", name)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+
+	s := New(append(append([]Option{WithAutoRestart()}, opts...), WithCtx(ctx))...)
+	entry := &managed{name: name, s: s, cancel: cancel}
+	s.onRestart = func() {
+		m.restarted(entry)
+	}
+
+	m.socks[name] = entry
+	m.order = append(m.order, name)
+
+	return s, nil
+}
+
+// Get gets the Sock by name, nil when not found
+func (m *Manager) Get(name string) *Sock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.socks[name]; ok {
+		return entry.s
+	}
+
+	return nil
+}
+
+// Names gets the name of all sockets in creation order
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string{}, m.order...)
+}
+
+// runner gets the run loop of socket by its type
+func runner(s *Sock) func() {
+	switch s.Type {
+	case goczmq.Pub, goczmq.Push:
+		return s.Publisher
+	case goczmq.Sub, goczmq.Pull:
+		return s.Consumer
+	case goczmq.Router:
+		return s.Router
+	case goczmq.Dealer:
+		return s.Dealer
+	case goczmq.Req:
+		return s.Requester
+	case goczmq.Rep:
+		return s.Responser
+	default:
+		return nil
+	}
+}
+
+// Run runs the loop of socket by its type and blocks until it exits
+func (s *Sock) Run() {
+	run := runner(s)
+	if run == nil {
+		panic(fmt.Errorf("sock has no run loop for type %s", TypeName(s.Type)))
+	}
+
+	run()
+}
+
+// Start starts the run loop of all sockets not started yet, in creation order
+func (m *Manager) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range m.order {
+		entry := m.socks[name]
+		if entry.started {
+			continue
+		}
+
+		run := runner(entry.s)
+		if run == nil {
+			return fmt.Errorf("sock %s has no run loop for type %s", name, TypeName(entry.s.Type))
+		}
+
+		entry.started = true
+		Pool.CtxGo(m.ctx, run)
+
+		log.Info().Str("name", name).Str("id", entry.s.ID).Msg("manager started sock")
+	}
+
+	return nil
+}
+
+// Stop stops all sockets in the reverse order of creation, ErrExitWaitTimeout is returned with the sockets not
+// released when the global deadline exceeded
+func (m *Manager) Stop() error {
+	m.mu.Lock()
+	order := append([]string{}, m.order...)
+	m.mu.Unlock()
+
+	deadline := time.Now().Add(m.deadline)
+
+	var left []string
+	for i := len(order) - 1; i >= 0; i-- {
+		m.mu.Lock()
+		entry := m.socks[order[i]]
+		m.mu.Unlock()
+
+		if !m.stop(entry, deadline) {
+			left = append(left, entry.name)
+		}
+	}
+
+	if len(left) > 0 {
+		return fmt.Errorf("%w: %s", ErrExitWaitTimeout, strings.Join(left, ","))
+	}
+
+	return nil
+}
+
+// stop releases one socket before deadline, returns false when it is not released in time
+func (m *Manager) stop(entry *managed, deadline time.Time) bool {
+	remain := time.Until(deadline)
+	if remain <= 0 {
+		entry.cancel()
+		return entry.s.IsClosed()
+	}
+
+	m.mu.Lock()
+	started := entry.started
+	m.mu.Unlock()
+
+	if !started {
+		entry.cancel()
+		entry.s.release()
+		return true
+	}
+
+	// Release in run loop must not wait beyond the global deadline
+	entry.s.exitWaitLimit.Store(int64(remain))
+
+	entry.cancel()
+
+	select {
+	case <-entry.s.done:
+		log.Info().Str("name", entry.name).Str("id", entry.s.ID).Msg("manager stopped sock")
+		return true
+	case <-time.After(remain):
+		log.Error().Str("name", entry.name).Str("id", entry.s.ID).Msg("manager failed to stop sock before deadline")
+		return false
+	}
+}
+
+// restarted records the restart of socket and warns when it is flapping
+func (m *Manager) restarted(entry *managed) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry.total++
+	entry.restarts = append(entry.restarts, now)
+
+	// only keep restarts in flap window
+	i := 0
+	for i < len(entry.restarts) && now.Sub(entry.restarts[i]) > DefaultFlapWindow {
+		i++
+	}
+
+	entry.restarts = entry.restarts[i:]
+
+	if len(entry.restarts) >= DefaultFlapThreshold {
+		log.Warn().Str("name", entry.name).Str("id", entry.s.ID).
+			Msgf("sock restarted %d times in %s", len(entry.restarts), DefaultFlapWindow)
+	}
+}
+
+// flapping reports whether socket restarted DefaultFlapThreshold times in DefaultFlapWindow
+func (entry *managed) flapping() bool {
+	if len(entry.restarts) < DefaultFlapThreshold {
+		return false
+	}
+
+	return time.Since(entry.restarts[len(entry.restarts)-DefaultFlapThreshold]) <= DefaultFlapWindow
+}
+
+// Flapping gets the name of sockets restarting in a loop
+func (m *Manager) Flapping() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for _, name := range m.order {
+		if m.socks[name].flapping() {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Status gets the status and counters of all sockets in creation order
+func (m *Manager) Status() []SockStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := make([]SockStatus, 0, len(m.order))
+	for _, name := range m.order {
+		entry := m.socks[name]
+
+		state := StateCreated
+		if entry.s.IsClosed() {
+			state = StateStopped
+		} else if entry.started {
+			state = StateRunning
+		}
+
+		status = append(status, SockStatus{
+			Name:     name,
+			ID:       entry.s.ID,
+			Type:     TypeName(entry.s.Type),
+			Endpoint: entry.s.endpointAddrs(),
+			State:    state,
+			In:       entry.s.GetInCount(),
+			Out:      entry.s.GetOutCount(),
+			Retry:    entry.s.GetRetryCount(),
+			Send:     entry.s.GetSendMsgCount(),
+			Recv:     entry.s.GetRecvMsgCount(),
+			Drop:     entry.s.GetDropMsgCount(),
+			Restarts: entry.total,
+			Flapping: entry.flapping(),
+		})
+	}
+
+	return status
+}
@@ -0,0 +1,84 @@
+package sock
+
+import (
+	"context"
+	A "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	assert := A.New(t)
+
+	m := NewManager(context.Background(), time.Second)
+
+	pull, err := m.Create("pull", WithType("PULL"), WithEndpoint("inproc://manager-pull"))
+	assert.Nil(err)
+	assert.Equal(m.Get("pull"), pull)
+
+	_, err = m.Create("push", WithType("PUSH"), WithEndpoint("inproc://manager-push"))
+	assert.Nil(err)
+
+	_, err = m.Create("pull", WithType("PULL"), WithEndpoint("inproc://manager-pull"))
+	assert.NotNil(err)
+
+	assert.Nil(m.Get("none"))
+	assert.Equal(m.Names(), []string{"pull", "push"})
+
+	status := m.Status()
+	assert.Equal(len(status), 2)
+	assert.Equal(status[0].Name, "pull")
+	assert.Equal(status[0].Type, "PULL")
+	assert.Equal(status[0].Endpoint, "inproc://manager-pull")
+	assert.Equal(status[0].State, StateCreated)
+
+	assert.Nil(pull.AddEndpoint("inproc://manager-pull-2", false))
+	assert.Nil(pull.RemoveEndpoint("inproc://manager-pull"))
+	assert.Equal(m.Status()[0].Endpoint, "inproc://manager-pull-2")
+
+	for i := 0; i < DefaultFlapThreshold; i++ {
+		pull.onRestart()
+	}
+
+	assert.Equal(m.Flapping(), []string{"pull"})
+	assert.Equal(m.Status()[0].Restarts, DefaultFlapThreshold)
+	assert.True(m.Status()[0].Flapping)
+	assert.False(m.Status()[1].Flapping)
+
+	assert.Nil(m.Stop())
+	for _, s := range m.Status() {
+		assert.Equal(s.State, StateStopped)
+	}
+}
+
+func TestAutoRestart(t *testing.T) {
+	assert := A.New(t)
+
+	// standalone socket exits on panic by default
+	s := New(WithType("PUSH"), WithEndpoint("inproc://manager-restart"))
+	assert.False(s.IsAutoRestart())
+
+	s = New(WithType("PUSH"), WithEndpoint("inproc://manager-restart"), WithExitWaitTimeout(time.Second), WithAutoRestart())
+	assert.True(s.IsAutoRestart())
+	assert.Equal(s.exitWait(), time.Second)
+
+	s.exitWaitLimit.Store(int64(time.Millisecond * 100))
+	assert.Equal(s.exitWait(), time.Millisecond*100)
+
+	s.StopAutoRestart()
+	assert.False(s.IsAutoRestart())
+
+	s = New(WithType("PUSH"), WithEndpoint("inproc://manager-restart"), DisableRestart(), WithAutoRestart())
+	assert.False(s.IsAutoRestart())
+
+	// socket of Manager restarts unless DisableRestart is set
+	m := NewManager(context.Background(), time.Second)
+
+	s, err := m.Create("push", WithType("PUSH"), WithEndpoint("inproc://manager-restart"))
+	assert.Nil(err)
+	assert.True(s.IsAutoRestart())
+
+	s, err = m.Create("pull", WithType("PULL"), WithEndpoint("inproc://manager-restart"), DisableRestart())
+	assert.Nil(err)
+	assert.False(s.IsAutoRestart())
+}
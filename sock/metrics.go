@@ -0,0 +1,129 @@
+package sock
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type sockMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func(s *Sock) float64
+}
+
+var sockMetrics = []sockMetric{
+	{"nops_sock_sent_msgs_total", "Total count of msg sock has published.", "counter",
+		func(s *Sock) float64 { return float64(s.GetSendMsgCount()) }},
+	{"nops_sock_received_msgs_total", "Total count of msg sock has received.", "counter",
+		func(s *Sock) float64 { return float64(s.GetRecvMsgCount()) }},
+	{"nops_sock_dropped_msgs_total", "Total count of msg sock has dropped.", "counter",
+		func(s *Sock) float64 { return float64(s.GetDropMsgCount()) }},
+	{"nops_sock_send_rate_msgs", "Msg sent per second in the last rate window.", "gauge",
+		func(s *Sock) float64 { msgs, _ := s.GetSendRate(); return msgs }},
+	{"nops_sock_send_rate_bytes", "Bytes sent per second in the last rate window.", "gauge",
+		func(s *Sock) float64 { _, bytes := s.GetSendRate(); return bytes }},
+	{"nops_sock_in_buffer_msgs", "Count of msg waiting in 'in' channel.", "gauge",
+		func(s *Sock) float64 { return float64(s.GetInCount()) }},
+	{"nops_sock_out_buffer_msgs", "Count of msg waiting in 'out' channel.", "gauge",
+		func(s *Sock) float64 { return float64(s.GetOutCount()) }},
+	{"nops_sock_retry_buffer_msgs", "Count of msg waiting for retry.", "gauge",
+		func(s *Sock) float64 { return float64(s.GetRetryCount()) }},
+	{"nops_sock_closed", "Whether sock has been released, 1 for released.", "gauge",
+		func(s *Sock) float64 {
+			if s.IsClosed() {
+				return 1
+			}
+
+			return 0
+		}},
+}
+
+/*
+Collector renders counters and buffer gauges of registered sockets in prometheus text format, every sample
+is labeled by socket id, type and endpoint. Collector is a http.Handler:
+
+	http.Handle("/metrics", sock.NewCollector(pub, sub))
+*/
+type Collector struct {
+	mu    sync.Mutex
+	socks []*Sock
+}
+
+// NewCollector creates a Collector with sockets registered
+func NewCollector(socks ...*Sock) *Collector {
+	c := &Collector{}
+	for _, s := range socks {
+		c.Register(s)
+	}
+
+	return c
+}
+
+// Register adds socket into collector, socket registered already is ignored
+func (c *Collector) Register(s *Sock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, registered := range c.socks {
+		if registered == s {
+			return
+		}
+	}
+
+	c.socks = append(c.socks, s)
+}
+
+// Unregister removes socket from collector
+func (c *Collector) Unregister(s *Sock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, registered := range c.socks {
+		if registered == s {
+			c.socks = append(c.socks[:i], c.socks[i+1:]...)
+			return
+		}
+	}
+}
+
+// escapeLabel escapes label value by the rule of prometheus text format
+func escapeLabel(val string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(val)
+}
+
+// WriteTo writes all metrics of registered sockets into w
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	socks := append([]*Sock{}, c.socks...)
+	c.mu.Unlock()
+
+	var buf strings.Builder
+	for _, m := range sockMetrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", m.name, m.kind)
+
+		for _, s := range socks {
+			fmt.Fprintf(&buf, "%s{id=\"%s\",type=\"%s\",endpoint=\"%s\"} %v\n",
+				m.name, escapeLabel(s.ID), TypeName(s.Type), escapeLabel(s.endpointAddrs()), m.value(s))
+		}
+	}
+
+	n, err := io.WriteString(w, buf.String())
+
+	return int64(n), err
+}
+
+// ServeHTTP writes metrics as the response of prometheus scraping
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", MetricsContentType)
+
+	if _, err := c.WriteTo(w); err != nil {
+		log.Error().Err(err).Msg("failed to write metrics")
+	}
+}
@@ -0,0 +1,50 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	assert := A.New(t)
+
+	push := New(WithType("PUSH"), WithEndpoint("inproc://metrics"))
+	pull := New(WithType("PULL"), WithEndpoint(`inproc://"metrics"`))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				push.sendMsgCount.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(push.GetSendMsgCount(), uint64(1000))
+
+	c := NewCollector(push, pull, push)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+	assert.Equal(w.Header().Get("Content-Type"), MetricsContentType)
+	assert.Contains(body, "# TYPE nops_sock_sent_msgs_total counter\n")
+	assert.Contains(body, `nops_sock_sent_msgs_total{id="`+push.ID+`",type="PUSH",endpoint="inproc://metrics"} 1000`)
+	assert.Contains(body, `endpoint="inproc://\"metrics\""`)
+	assert.Equal(strings.Count(body, `nops_sock_sent_msgs_total{`), 2)
+
+	c.Unregister(pull)
+
+	var buf strings.Builder
+	n, err := c.WriteTo(&buf)
+	assert.Nil(err)
+	assert.Equal(int(n), buf.Len())
+	assert.NotContains(buf.String(), pull.ID)
+}
@@ -0,0 +1,304 @@
+package sock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/zeromq/goczmq"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MonitorEventType is the zeromq socket monitor event
+type MonitorEventType uint16
+
+const (
+	EventConnected               MonitorEventType = 0x0001
+	EventConnectDelayed          MonitorEventType = 0x0002
+	EventConnectRetried          MonitorEventType = 0x0004
+	EventListening               MonitorEventType = 0x0008
+	EventBindFailed              MonitorEventType = 0x0010
+	EventAccepted                MonitorEventType = 0x0020
+	EventAcceptFailed            MonitorEventType = 0x0040
+	EventClosed                  MonitorEventType = 0x0080
+	EventCloseFailed             MonitorEventType = 0x0100
+	EventDisconnected            MonitorEventType = 0x0200
+	EventMonitorStopped          MonitorEventType = 0x0400
+	EventHandshakeFailedNoDetail MonitorEventType = 0x0800
+	EventHandshakeSucceeded      MonitorEventType = 0x1000
+	EventHandshakeFailedProtocol MonitorEventType = 0x2000
+	EventHandshakeFailedAuth     MonitorEventType = 0x4000
+
+	// EventAll subscribes all events
+	EventAll MonitorEventType = 0xffff
+
+	DefaultMonitorRecvTimeoutMillSec = 100
+)
+
+var eventNames = map[MonitorEventType]string{
+	EventConnected:               "CONNECTED",
+	EventConnectDelayed:          "CONNECT_DELAYED",
+	EventConnectRetried:          "CONNECT_RETRIED",
+	EventListening:               "LISTENING",
+	EventBindFailed:              "BIND_FAILED",
+	EventAccepted:                "ACCEPTED",
+	EventAcceptFailed:            "ACCEPT_FAILED",
+	EventClosed:                  "CLOSED",
+	EventCloseFailed:             "CLOSE_FAILED",
+	EventDisconnected:            "DISCONNECTED",
+	EventMonitorStopped:          "MONITOR_STOPPED",
+	EventHandshakeFailedNoDetail: "HANDSHAKE_FAILED_NO_DETAIL",
+	EventHandshakeSucceeded:      "HANDSHAKE_SUCCEEDED",
+	EventHandshakeFailedProtocol: "HANDSHAKE_FAILED_PROTOCOL",
+	EventHandshakeFailedAuth:     "HANDSHAKE_FAILED_AUTH",
+}
+
+// String gets the name of event
+func (e MonitorEventType) String() string {
+	if name, ok := eventNames[e]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("UNKNOWN(0x%04x)", uint16(e))
+}
+
+// HandshakeFailed reports whether event is one of handshake failures
+func (e MonitorEventType) HandshakeFailed() bool {
+	return e == EventHandshakeFailedNoDetail || e == EventHandshakeFailedProtocol || e == EventHandshakeFailedAuth
+}
+
+// MonitorEvent is an event published by zeromq socket monitor
+type MonitorEvent struct {
+	Type     MonitorEventType
+	Value    uint32
+	Endpoint string
+	SockID   string
+	Time     time.Time
+}
+
+/*
+parseMonitorEvent parses the message published by socket monitor
+
+	frame 1: | 2 bytes event | 4 bytes value |, in host byte order
+	frame 2: | endpoint |
+*/
+func parseMonitorEvent(frames [][]byte) (MonitorEvent, error) {
+	if len(frames) != 2 || len(frames[0]) != 6 {
+		return MonitorEvent{}, fmt.Errorf("malformed monitor event")
+	}
+
+	return MonitorEvent{
+		Type:     MonitorEventType(binary.LittleEndian.Uint16(frames[0][:2])),
+		Value:    binary.LittleEndian.Uint32(frames[0][2:]),
+		Endpoint: string(frames[1]),
+		Time:     time.Now(),
+	}, nil
+}
+
+// MonitorHandler receives socket monitor events, it is called in the monitor thread and should not block
+type MonitorHandler func(event MonitorEvent)
+
+// EndpointState is the peer connectivity of one endpoint of socket
+type EndpointState struct {
+	// Listening is true when socket is bound on endpoint
+	Listening bool
+	// Peers is the count of peers connected on endpoint
+	Peers int
+}
+
+// SockState is the peer connectivity of socket reported by socket monitor
+type SockState struct {
+	// Monitored is false when socket monitor is not enabled, other fields are meaningless then
+	Monitored bool
+	// Listening is true when socket is bound on any endpoint
+	Listening bool
+	// Peers is the count of connected peers on all endpoints
+	Peers int
+	// Endpoints is the state of every endpoint address reported by events
+	Endpoints map[string]EndpointState
+	// LastEvent is the latest event of socket
+	LastEvent MonitorEvent
+}
+
+// Connected reports whether at least one peer is connected
+func (st SockState) Connected() bool {
+	return st.Peers > 0
+}
+
+// monitorState tracks socket monitor events
+type monitorState struct {
+	mu       sync.Mutex
+	enabled  bool
+	handlers []MonitorHandler
+	seq      atomic.Uint64
+	state    SockState
+	// state of every endpoint address, state is aggregated from it
+	endpoints map[string]*EndpointState
+}
+
+// update applies event on the state of its endpoint and aggregates state of socket
+func (m *monitorState) update(event MonitorEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.endpoints == nil {
+		m.endpoints = make(map[string]*EndpointState)
+	}
+
+	ep, ok := m.endpoints[event.Endpoint]
+	if !ok {
+		ep = &EndpointState{}
+		m.endpoints[event.Endpoint] = ep
+	}
+
+	switch event.Type {
+	case EventListening:
+		ep.Listening = true
+	case EventConnected, EventAccepted:
+		ep.Peers++
+	case EventDisconnected:
+		if ep.Peers > 0 {
+			ep.Peers--
+		}
+	case EventClosed:
+		// only the endpoint closed is affected, the others of socket are still alive
+		delete(m.endpoints, event.Endpoint)
+	case EventMonitorStopped:
+		m.endpoints = make(map[string]*EndpointState)
+	}
+
+	m.state.Listening = false
+	m.state.Peers = 0
+	for _, ep := range m.endpoints {
+		m.state.Listening = m.state.Listening || ep.Listening
+		m.state.Peers += ep.Peers
+	}
+
+	m.state.LastEvent = event
+}
+
+// snapshot gets a copy of state
+func (m *monitorState) snapshot() SockState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state
+	st.Endpoints = make(map[string]EndpointState, len(m.endpoints))
+	for addr, ep := range m.endpoints {
+		st.Endpoints[addr] = *ep
+	}
+
+	return st
+}
+
+// reset clears state of a new socket
+func (m *monitorState) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = SockState{Monitored: true}
+	m.endpoints = make(map[string]*EndpointState)
+}
+
+// EnableMonitor attaches socket monitor on socket, so State reports peer connectivity
+func EnableMonitor() Option {
+	return func(s *Sock) {
+		s.monitor.enabled = true
+	}
+}
+
+// WithMonitor attaches socket monitor on socket and calls handler with every event
+func WithMonitor(handler MonitorHandler) Option {
+	return func(s *Sock) {
+		s.monitor.enabled = true
+		s.monitor.handlers = append(s.monitor.handlers, handler)
+	}
+}
+
+// WithMonitorChannel attaches socket monitor on socket and sends every event into ch, event is dropped when ch is full
+func WithMonitorChannel(ch chan MonitorEvent) Option {
+	return WithMonitor(func(event MonitorEvent) {
+		select {
+		case ch <- event:
+		default:
+			log.Warn().Str("id", event.SockID).Str("event", event.Type.String()).Msg("monitor channel is full, drop event")
+		}
+	})
+}
+
+// State gets the peer connectivity of socket, socket monitor must be enabled
+func (s *Sock) State() SockState {
+	return s.monitor.snapshot()
+}
+
+// startMonitor attaches socket monitor on soc before it binds or connects and receives events in a new thread
+func (s *Sock) startMonitor(soc *goczmq.Sock) {
+	if !s.monitor.enabled {
+		return
+	}
+
+	endpoint := fmt.Sprintf("inproc://nops-monitor-%s-%d", s.ID, s.monitor.seq.Add(1))
+	if err := socketMonitor(soc, endpoint, int(EventAll)); err != nil {
+		log.Error().Err(err).Msg("failed to attach socket monitor")
+		return
+	}
+
+	pair := goczmq.NewSock(goczmq.Pair)
+	pair.SetRcvtimeo(DefaultMonitorRecvTimeoutMillSec)
+
+	if err := pair.Connect(endpoint); err != nil {
+		log.Error().Err(err).Msg("failed to connect socket monitor")
+		pair.Destroy()
+		return
+	}
+
+	s.monitor.reset()
+
+	Pool.CtxGo(s.ctx, func() {
+		s.recvMonitor(pair)
+	})
+}
+
+// recvMonitor receives events from monitor PAIR socket until monitor stopped or ctx done
+func (s *Sock) recvMonitor(pair *goczmq.Sock) {
+	defer pair.Destroy()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+
+		frames, err := pair.RecvMessage()
+		if err != nil {
+			// receive timeout
+			continue
+		}
+
+		event, err := parseMonitorEvent(frames)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to parse monitor event")
+			continue
+		}
+
+		event.SockID = s.ID
+
+		connected := s.State().Connected()
+		s.monitor.update(event)
+
+		if !connected && s.State().Connected() {
+			s.peerConnected()
+		}
+
+		log.Debug().Str("id", s.ID).Str("event", event.Type.String()).Str("endpoint", event.Endpoint).Msg("socket event")
+
+		for _, handler := range s.monitor.handlers {
+			handler(event)
+		}
+
+		if event.Type == EventMonitorStopped {
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseMonitorEvent(t *testing.T) {
+	assert := A.New(t)
+
+	event, err := parseMonitorEvent([][]byte{{0x20, 0x00, 0x07, 0x00, 0x00, 0x00}, []byte("tcp://127.0.0.1:5555")})
+	assert.Nil(err)
+	assert.Equal(event.Type, EventAccepted)
+	assert.Equal(event.Type.String(), "ACCEPTED")
+	assert.Equal(event.Value, uint32(7))
+	assert.Equal(event.Endpoint, "tcp://127.0.0.1:5555")
+
+	_, err = parseMonitorEvent([][]byte{{0x20, 0x00}})
+	assert.NotNil(err)
+
+	assert.True(EventHandshakeFailedAuth.HandshakeFailed())
+	assert.Equal(MonitorEventType(0x8000).String(), "UNKNOWN(0x8000)")
+}
+
+func TestMonitorState(t *testing.T) {
+	assert := A.New(t)
+
+	m := &monitorState{}
+	m.reset()
+
+	m.update(MonitorEvent{Type: EventListening})
+	m.update(MonitorEvent{Type: EventAccepted})
+	m.update(MonitorEvent{Type: EventAccepted})
+	m.update(MonitorEvent{Type: EventDisconnected})
+
+	assert.True(m.state.Monitored)
+	assert.True(m.state.Listening)
+	assert.Equal(m.state.Peers, 1)
+	assert.True(m.state.Connected())
+	assert.Equal(m.state.LastEvent.Type, EventDisconnected)
+
+	m.update(MonitorEvent{Type: EventClosed})
+	assert.False(m.state.Connected())
+}
+
+func TestMonitorStatePerEndpoint(t *testing.T) {
+	assert := A.New(t)
+
+	m := &monitorState{}
+	m.reset()
+
+	m.update(MonitorEvent{Type: EventListening, Endpoint: "tcp://127.0.0.1:5555"})
+	m.update(MonitorEvent{Type: EventAccepted, Endpoint: "tcp://127.0.0.1:5555"})
+	m.update(MonitorEvent{Type: EventListening, Endpoint: "tcp://127.0.0.1:5556"})
+	m.update(MonitorEvent{Type: EventConnected, Endpoint: "tcp://127.0.0.1:5557"})
+
+	st := m.snapshot()
+	assert.True(st.Listening)
+	assert.Equal(st.Peers, 2)
+	assert.Equal(len(st.Endpoints), 3)
+
+	m.update(MonitorEvent{Type: EventClosed, Endpoint: "tcp://127.0.0.1:5555"})
+
+	st = m.snapshot()
+	assert.True(st.Listening)
+	assert.Equal(st.Peers, 1)
+	assert.True(st.Endpoints["tcp://127.0.0.1:5556"].Listening)
+	_, ok := st.Endpoints["tcp://127.0.0.1:5555"]
+	assert.False(ok)
+
+	m.update(MonitorEvent{Type: EventClosed, Endpoint: "tcp://127.0.0.1:5556"})
+	assert.False(m.snapshot().Listening)
+	assert.True(m.snapshot().Connected())
+
+	m.update(MonitorEvent{Type: EventMonitorStopped})
+	assert.False(m.snapshot().Connected())
+}
@@ -0,0 +1,40 @@
+package sock
+
+/*
+#cgo !windows pkg-config: libczmq libzmq libsodium
+#cgo windows LDFLAGS: -lws2_32 -liphlpapi -lrpcrt4 -lsodium -lzmq -lczmq
+#include "czmq.h"
+#include <stdlib.h>
+
+static int sock_monitor(void *self, const char *endpoint, int events) {
+	return zmq_socket_monitor(zsock_resolve(self), endpoint, events);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"github.com/zeromq/goczmq"
+	"unsafe"
+)
+
+/*
+socketMonitor starts zeromq socket monitor on soc, events are published to the PAIR socket connecting endpoint.
+
+	goczmq does not bind zmq_socket_monitor, the zsock_t pointer is the first field of goczmq.Sock
+*/
+func socketMonitor(soc *goczmq.Sock, endpoint string, events int) error {
+	handle := *(*unsafe.Pointer)(unsafe.Pointer(soc))
+	if handle == nil {
+		return fmt.Errorf("sock pointer is nil")
+	}
+
+	cEndpoint := C.CString(endpoint)
+	defer C.free(unsafe.Pointer(cEndpoint))
+
+	if rc := C.sock_monitor(handle, cEndpoint, C.int(events)); rc == -1 {
+		return fmt.Errorf("zmq_socket_monitor failed on %s", endpoint)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package sock
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+Message is a multipart zeromq message, each element is one frame. A socket created with WithMultipart
+exchanges Message through 'in' and 'out' channel in the form of Message.Bytes()
+
+	| uvarint frame count | uvarint frame length | frame | uvarint frame length | frame | ...
+*/
+type Message [][]byte
+
+// NewMessage creates a Message with frames
+func NewMessage(frames ...[]byte) Message {
+	return frames
+}
+
+// Size gets the total length of all frames
+func (m Message) Size() int {
+	size := 0
+	for _, frame := range m {
+		size += len(frame)
+	}
+
+	return size
+}
+
+// Bytes encodes the Message into one buffer which can be put into 'in' channel
+func (m Message) Bytes() []byte {
+	buf := make([]byte, 0, binary.MaxVarintLen64*(len(m)+1)+m.Size())
+	buf = binary.AppendUvarint(buf, uint64(len(m)))
+
+	for _, frame := range m {
+		buf = binary.AppendUvarint(buf, uint64(len(frame)))
+		buf = append(buf, frame...)
+	}
+
+	return buf
+}
+
+// ParseMessage decodes buffer created by Message.Bytes
+func ParseMessage(buf []byte) (Message, error) {
+	count, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, fmt.Errorf("malformed message: bad frame count")
+	}
+
+	// every frame takes one byte at least
+	if count > uint64(len(buf)) {
+		return nil, fmt.Errorf("malformed message: frame count %d exceeds buffer length %d", count, len(buf))
+	}
+
+	buf = buf[n:]
+	m := make(Message, 0, count)
+
+	for i := uint64(0); i < count; i++ {
+		size, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, fmt.Errorf("malformed message: bad length of frame %d", i)
+		}
+
+		buf = buf[n:]
+		if size > uint64(len(buf)) {
+			return nil, fmt.Errorf("malformed message: frame %d length %d exceeds buffer length %d", i, size, len(buf))
+		}
+
+		m = append(m, buf[:size])
+		buf = buf[size:]
+	}
+
+	if len(buf) != 0 {
+		return nil, fmt.Errorf("malformed message: %d trailing bytes", len(buf))
+	}
+
+	return m, nil
+}
@@ -0,0 +1,33 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	assert := A.New(t)
+
+	m := NewMessage([]byte("header"), []byte(""), []byte("body"))
+	assert.Equal(m.Size(), 10)
+
+	parsed, err := ParseMessage(m.Bytes())
+	assert.Nil(err)
+	assert.Equal(len(parsed), 3)
+	assert.Equal(parsed[0], []byte("header"))
+	assert.Equal(parsed[1], []byte(""))
+	assert.Equal(parsed[2], []byte("body"))
+
+	parsed, err = ParseMessage(NewMessage().Bytes())
+	assert.Nil(err)
+	assert.Equal(len(parsed), 0)
+
+	_, err = ParseMessage([]byte{})
+	assert.NotNil(err)
+
+	_, err = ParseMessage([]byte{1, 5, 'a'})
+	assert.NotNil(err)
+
+	_, err = ParseMessage(append(m.Bytes(), 'x'))
+	assert.NotNil(err)
+}
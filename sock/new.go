@@ -2,13 +2,14 @@ package sock
 
 import (
 	"context"
+	"fmt"
 	"github.com/lafrinte/nops/str"
 	"github.com/zeromq/goczmq"
 )
 
 func New(opts ...Option) *Sock {
 	soc := &Sock{
-		id:                     str.ID().String(),
+		ID:                     str.ID().String(),
 		RetryAttempts:          DefaultRetryAttempts,
 		RetryInterval:          DefaultRetryInterval,
 		MaxBufferSize:          DefaultMaxBufferSize,
@@ -22,10 +23,20 @@ func New(opts ...Option) *Sock {
 		ReconnectIvlMillSec:    DefaultReconnectIvlMillSec,
 		ReconnectIvlMaxMillSec: DefaultReconnectIvlMaxMillSec,
 		Sndhwm:                 DefaultSndhwm,
-		dropMsgCount:           0,
-		sendMsgCount:           0,
 		RecvTimeoutSec:         DefaultRecvTimeoutSec,
 		SendTimeoutSec:         DefaultSendTimeoutSec,
+		topics:                 make(map[string]struct{}),
+		subscribed:             make(map[string]struct{}),
+		routes:                 make(map[string][][]byte),
+		ctl:                    make(chan func(soc *goczmq.Sock), DefaultCtlBufferSize),
+		delayed:                newRetryQueue(),
+		batch:                  newBatcher(),
+		lanes:                  newLaneSet(),
+		dedupe:                 newSequencer(),
+		acks:                   newAcker(),
+		limiter:                newRateLimiter(),
+		sendRate:               newRateMeter(DefaultRateWindow),
+		done:                   make(chan struct{}),
 	}
 
 	for _, opt := range opts {
@@ -36,6 +47,18 @@ func New(opts ...Option) *Sock {
 		soc.ctx = context.Background()
 	}
 
+	if soc.producerID == "" {
+		soc.producerID = soc.ID
+	}
+
+	if soc.backoff == nil {
+		soc.backoff = NewConstantBackoff(soc.RetryInterval)
+	}
+
+	soc.initEndpoints()
+	soc.watchDiscovery()
+	soc.initSpool()
+
 	switch soc.Type {
 	case goczmq.Pub, goczmq.Push:
 		if soc.in == nil {
@@ -50,6 +73,16 @@ func New(opts ...Option) *Sock {
 
 		soc.in = make(chan []byte, 0)
 		soc.retryCh = make(chan *RetryMsg, 0)
+	case goczmq.Router, goczmq.Dealer, goczmq.XPub, goczmq.XSub:
+		if soc.in == nil {
+			soc.in = make(chan []byte, soc.MaxBufferSize)
+		}
+
+		if soc.out == nil {
+			soc.out = make(chan []byte, soc.MaxBufferSize)
+		}
+
+		soc.retryCh = make(chan *RetryMsg, soc.MaxBufferSize)
 	case goczmq.Req, goczmq.Rep:
 		soc.in = make(chan []byte, 1)
 		soc.out = make(chan []byte, 1)
@@ -64,5 +97,16 @@ func New(opts ...Option) *Sock {
 		}
 	}
 
+	if soc.topic != "" && soc.Type != goczmq.Pub && soc.Type != goczmq.XPub {
+		panic(fmt.Errorf("topic only enables by 'type': Pub/XPub"))
+	}
+
+	if len(soc.lanes.lanes) > 0 && soc.Type != goczmq.Pub && soc.Type != goczmq.Push {
+		panic(fmt.Errorf("lanes only enable by 'type': Push/Pub"))
+	}
+
+	soc.lanes.init(soc.in, &soc.inOverflow, soc.MaxBufferSize)
+	soc.initAck()
+
 	return soc
 }
@@ -23,6 +23,8 @@ const (
 	DefaultSndhwm                 = 10000
 	DefaultSendTimeoutSec         = 0
 	DefaultRecvTimeoutSec         = 0
+	DefaultPollTimeoutMillSec     = 10
+	DefaultCtlBufferSize          = 64
 )
 
 type Option func(s *Sock)
@@ -40,12 +42,14 @@ func WithType(val string) Option {
 			s.Type = goczmq.Pub
 		case "SUB":
 			s.Type = goczmq.Sub
-
-		// enable in next pr
-		//case "ROUTER":
-		//	s.Type = goczmq.Router
-		//case "DEALER":
-		//	s.Type = goczmq.Dealer
+		case "XPUB":
+			s.Type = goczmq.XPub
+		case "XSUB":
+			s.Type = goczmq.XSub
+		case "ROUTER":
+			s.Type = goczmq.Router
+		case "DEALER":
+			s.Type = goczmq.Dealer
 		case "PUSH":
 			s.Type = goczmq.Push
 		case "PULL":
@@ -61,6 +65,34 @@ func WithType(val string) Option {
 	}
 }
 
+// TypeName gets the name of socket type set by WithType, e.g. "PUB"
+func TypeName(val int) string {
+	switch val {
+	case goczmq.Pub:
+		return "PUB"
+	case goczmq.Sub:
+		return "SUB"
+	case goczmq.XPub:
+		return "XPUB"
+	case goczmq.XSub:
+		return "XSUB"
+	case goczmq.Router:
+		return "ROUTER"
+	case goczmq.Dealer:
+		return "DEALER"
+	case goczmq.Push:
+		return "PUSH"
+	case goczmq.Pull:
+		return "PULL"
+	case goczmq.Req:
+		return "REQ"
+	case goczmq.Rep:
+		return "REP"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 func WithCtx(val context.Context) Option {
 	return func(s *Sock) {
 		s.ctx = val
@@ -73,12 +105,35 @@ func WithEndpoint(val string) Option {
 	}
 }
 
+// WithIdentity sets the routing id of socket, which is seen by the ROUTER peer as the identity frame
+func WithIdentity(val string) Option {
+	return func(s *Sock) {
+		s.Identity = val
+	}
+}
+
+// WithMultipart makes socket exchange multipart Message through 'in' and 'out' channel. msg put into 'in'
+// channel must be created by Message.Bytes, msg got from 'out' channel can be decoded by ParseMessage
+func WithMultipart() Option {
+	return func(s *Sock) {
+		s.multipart = true
+	}
+}
+
 func WithAttach() Option {
 	return func(s *Sock) {
 		s.attach = true
 	}
 }
 
+// WithAutoRestart restarts the run loop on a new socket after ReconnectIvlMillSec when it panics, socket created by
+// Manager restarts by default. run loop exits on panic without it
+func WithAutoRestart() Option {
+	return func(s *Sock) {
+		s.autoRestart = true
+	}
+}
+
 func DisableRestart() Option {
 	return func(s *Sock) {
 		s.DisableRestart.Set(true)
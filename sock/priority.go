@@ -0,0 +1,341 @@
+package sock
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// LanePolicy is the order Publisher drains priority lanes
+type LanePolicy uint8
+
+const (
+	// LaneStrict always drains the lane of highest priority which has msg, it is the default policy
+	LaneStrict LanePolicy = iota
+	// LaneWeighted drains lanes having msg by smooth weighted round-robin, so low priority lanes are not starved
+	LaneWeighted
+)
+
+// DefaultLane is the name of 'in' channel, it is the lane of lowest priority with weight 1
+const DefaultLane = "default"
+
+// Lane is a priority input lane of Publisher, Size is its buffer size, MaxBufferSize by default, and Weight works
+// with LaneWeighted
+type Lane struct {
+	Name   string
+	Size   int
+	Weight int
+}
+
+// LaneStats is the counters of a priority lane
+type LaneStats struct {
+	Name string
+	// Len is the count of msg waiting in lane
+	Len int
+	// Cap is the buffer size of lane
+	Cap int
+	// Sent is the count of msg taken from lane by Publisher
+	Sent uint64
+	// Overflow is the counters of the overflow policy set by WithInOverflow, applies to PutLane
+	Overflow OverflowStats
+}
+
+type lane struct {
+	name   string
+	size   int
+	weight int
+	ch     chan []byte
+
+	// current weight of smooth weighted round-robin
+	current int
+
+	sent     atomic.Uint64
+	overflow *overflow
+}
+
+// laneSet is the priority lanes in descending order, 'in' channel is always the last one
+type laneSet struct {
+	mu     sync.Mutex
+	policy LanePolicy
+	lanes  []*lane
+	byName map[string]*lane
+
+	// msg taken from 'in' channel by Publisher, it waits here for the turn of DefaultLane
+	head    []byte
+	holding bool
+
+	// signaled when msg is put into a lane, nil when no lane is set so it never fires
+	ready chan struct{}
+}
+
+func newLaneSet() *laneSet {
+	return &laneSet{byName: make(map[string]*lane)}
+}
+
+/*
+WithLanes adds priority input lanes to Publisher in descending priority, 'in' channel is the lane DefaultLane of
+lowest priority. msg is put into lane by PutLane, every lane has its own buffer and counters. msg of all lanes,
+'in' channel included, is sent in the order of policy.
+
+	s := sock.New(
+		sock.WithType("PUSH"),
+		sock.WithLanes(sock.LaneStrict, sock.Lane{Name: "control", Size: 16}, sock.Lane{Name: "config", Size: 64}),
+	)
+	_ = s.PutLane("control", []byte("shutdown"))
+*/
+func WithLanes(policy LanePolicy, lanes ...Lane) Option {
+	return func(s *Sock) {
+		s.lanes.policy = policy
+
+		for _, l := range lanes {
+			if l.Name == "" || l.Name == DefaultLane {
+				panic(fmt.Errorf("invalid lane name: %q", l.Name))
+			}
+
+			if _, ok := s.lanes.byName[l.Name]; ok {
+				panic(fmt.Errorf("duplicate lane: %s", l.Name))
+			}
+
+			if l.Weight <= 0 {
+				l.Weight = 1
+			}
+
+			ln := &lane{name: l.Name, size: l.Size, weight: l.Weight, overflow: &overflow{}}
+			s.lanes.lanes = append(s.lanes.lanes, ln)
+			s.lanes.byName[l.Name] = ln
+		}
+	}
+}
+
+// init creates channel of lanes and appends 'in' channel as the default lane, it is called after all options
+func (ls *laneSet) init(in chan []byte, inOverflow *overflow, size int) {
+	for _, l := range ls.lanes {
+		if l.size <= 0 {
+			l.size = size
+		}
+
+		l.ch = make(chan []byte, l.size)
+		l.overflow.policy = inOverflow.policy
+		l.overflow.timeout = inOverflow.timeout
+	}
+
+	if len(ls.lanes) > 0 {
+		ls.ready = make(chan struct{}, 1)
+	}
+
+	def := &lane{name: DefaultLane, weight: 1, ch: in, overflow: inOverflow}
+	ls.lanes = append(ls.lanes, def)
+	ls.byName[DefaultLane] = def
+}
+
+// enabled reports whether lanes are set by WithLanes
+func (ls *laneSet) enabled() bool {
+	return ls.ready != nil
+}
+
+// notify signals ready without blocking
+func (ls *laneSet) notify() {
+	select {
+	case ls.ready <- struct{}{}:
+	default:
+	}
+}
+
+// hold keeps msg taken from 'in' channel until DefaultLane is picked by policy, 'in' channel is not read while
+// msg is held
+func (ls *laneSet) hold(msg []byte) {
+	ls.mu.Lock()
+	ls.head = msg
+	ls.holding = true
+	ls.mu.Unlock()
+
+	ls.notify()
+}
+
+// held reports whether a msg taken from 'in' channel is waiting
+func (ls *laneSet) held() bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	return ls.holding
+}
+
+// size gets the count of msg waiting in lane l, the msg held is counted in DefaultLane
+func (ls *laneSet) size(l *lane) int {
+	if l.name == DefaultLane && ls.holding {
+		return len(l.ch) + 1
+	}
+
+	return len(l.ch)
+}
+
+// take removes one msg from lane l without blocking, the msg held goes first in DefaultLane
+func (ls *laneSet) take(l *lane) ([]byte, bool) {
+	if l.name == DefaultLane && ls.holding {
+		msg := ls.head
+		ls.head, ls.holding = nil, false
+
+		return msg, true
+	}
+
+	select {
+	case msg := <-l.ch:
+		return msg, true
+	default:
+		return nil, false
+	}
+}
+
+// next takes one msg by policy without blocking, ready is signaled again when lanes still have msg
+func (ls *laneSet) next() ([]byte, bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var picked *lane
+	switch ls.policy {
+	case LaneWeighted:
+		total := 0
+		for _, l := range ls.lanes {
+			if ls.size(l) == 0 {
+				continue
+			}
+
+			l.current += l.weight
+			total += l.weight
+
+			if picked == nil || l.current > picked.current {
+				picked = l
+			}
+		}
+
+		if picked != nil {
+			picked.current -= total
+		}
+	default:
+		for _, l := range ls.lanes {
+			if ls.size(l) > 0 {
+				picked = l
+				break
+			}
+		}
+	}
+
+	if picked == nil {
+		return nil, false
+	}
+
+	msg, ok := ls.take(picked)
+	if !ok {
+		return nil, false
+	}
+
+	picked.sent.Add(1)
+
+	for _, l := range ls.lanes {
+		if ls.size(l) > 0 {
+			ls.notify()
+			break
+		}
+	}
+
+	return msg, true
+}
+
+// Len gets the count of msg in lanes except 'in' channel, the msg held is counted
+func (ls *laneSet) Len() int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	n := 0
+	if ls.holding {
+		n++
+	}
+
+	for _, l := range ls.lanes[:len(ls.lanes)-1] {
+		n += len(l.ch)
+	}
+
+	return n
+}
+
+// drain removes and returns all msg in lanes except 'in' channel, the msg held is returned
+func (ls *laneSet) drain() [][]byte {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var msgs [][]byte
+	if ls.holding {
+		msgs = append(msgs, ls.head)
+		ls.head, ls.holding = nil, false
+	}
+
+	for _, l := range ls.lanes[:len(ls.lanes)-1] {
+		for len(l.ch) > 0 {
+			select {
+			case msg := <-l.ch:
+				msgs = append(msgs, msg)
+			default:
+			}
+		}
+	}
+
+	return msgs
+}
+
+// inChannel gets 'in' channel read by select of Publisher. with lanes, a msg taken from it is held until DefaultLane is
+// picked by policy, so it is nil while a msg is held
+func (s *Sock) inChannel() chan []byte {
+	if s.lanes.enabled() && s.lanes.held() {
+		return nil
+	}
+
+	return s.in
+}
+
+// take handles msg taken from 'in' channel by select of Publisher, it is held for lanes or sent at once
+func (s *Sock) take(msg []byte) {
+	if s.lanes.enabled() {
+		s.lanes.hold(msg)
+		return
+	}
+
+	if s.throttle(msg) {
+		s.publish(msg)
+	}
+}
+
+// PutLane puts msg into lane by name with the overflow policy set by WithInOverflow, DefaultLane is 'in' channel
+func (s *Sock) PutLane(name string, msg []byte) error {
+	if s.IsClosed() {
+		return ErrClosed
+	}
+
+	l, ok := s.lanes.byName[name]
+	if !ok {
+		return fmt.Errorf("unknown lane: %s", name)
+	}
+
+	if err := l.overflow.put(s.ctx, s.done, l.ch, msg, s.dropped); err != nil {
+		return err
+	}
+
+	s.lanes.notify()
+
+	return nil
+}
+
+// GetLaneStats gets the counters of all lanes in descending priority, DefaultLane is the last one
+func (s *Sock) GetLaneStats() []LaneStats {
+	stats := make([]LaneStats, 0, len(s.lanes.lanes))
+	for _, l := range s.lanes.lanes {
+		stats = append(stats, LaneStats{
+			Name:     l.name,
+			Len:      len(l.ch),
+			Cap:      cap(l.ch),
+			Sent:     l.sent.Load(),
+			Overflow: l.overflow.stats(),
+		})
+	}
+
+	return stats
+}
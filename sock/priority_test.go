@@ -0,0 +1,133 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLaneStrict(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://lanes"),
+		WithMaxBufferSize(10),
+		WithLanes(LaneStrict, Lane{Name: "control", Size: 2}, Lane{Name: "config"}),
+	)
+
+	soc.GetInChannel() <- []byte("telemetry")
+	assert.Nil(soc.PutLane("config", []byte("config")))
+	assert.Nil(soc.PutLane("control", []byte("shutdown")))
+	assert.Nil(soc.PutLane(DefaultLane, []byte("telemetry")))
+
+	assert.NotNil(soc.PutLane("unknown", []byte("a")))
+	assert.Equal(soc.lanes.Len(), 2)
+	assert.False(soc.EmptyBuffer())
+
+	var got []string
+	for {
+		b, ok := soc.lanes.next()
+		if !ok {
+			break
+		}
+
+		got = append(got, string(b))
+	}
+
+	assert.Equal(got, []string{"shutdown", "config", "telemetry", "telemetry"})
+
+	stats := soc.GetLaneStats()
+	assert.Equal(len(stats), 3)
+	assert.Equal(stats[0].Name, "control")
+	assert.Equal(stats[0].Cap, 2)
+	assert.Equal(stats[0].Sent, uint64(1))
+	assert.Equal(stats[1].Cap, 10)
+	assert.Equal(stats[2].Name, DefaultLane)
+	assert.Equal(stats[2].Sent, uint64(2))
+}
+
+func TestLaneWeighted(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://lanes"),
+		WithMaxBufferSize(100),
+		WithLanes(LaneWeighted, Lane{Name: "high", Weight: 3}),
+	)
+
+	for i := 0; i < 20; i++ {
+		assert.Nil(soc.PutLane("high", []byte("high")))
+		assert.Nil(soc.Put([]byte("low")))
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		b, ok := soc.lanes.next()
+		assert.True(ok)
+		counts[string(b)]++
+	}
+
+	assert.Equal(counts["high"], 6)
+	assert.Equal(counts["low"], 2)
+}
+
+func TestLaneOverflow(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://lanes"),
+		WithInOverflow(OverflowDropNewest, 0),
+		WithLanes(LaneStrict, Lane{Name: "control", Size: 1}),
+	)
+
+	assert.Nil(soc.PutLane("control", []byte("a")))
+	assert.Equal(soc.PutLane("control", []byte("b")), ErrBufferFull)
+	assert.Equal(soc.GetLaneStats()[0].Overflow.DropNewest, uint64(1))
+	assert.Equal(soc.GetInOverflowStats().DropNewest, uint64(0))
+
+	assert.Panics(func() {
+		New(WithType("Pull"), WithEndpoint("inproc://lanes"), WithLanes(LaneStrict, Lane{Name: "control"}))
+	})
+
+	assert.Panics(func() {
+		New(WithType("Push"), WithEndpoint("inproc://lanes"), WithLanes(LaneStrict, Lane{Name: DefaultLane}))
+	})
+}
+
+func TestLaneHold(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("Push"),
+		WithEndpoint("inproc://lanes"),
+		WithMaxBufferSize(100),
+		WithLanes(LaneWeighted, Lane{Name: "high", Weight: 3}),
+	)
+
+	for i := 0; i < 20; i++ {
+		assert.Nil(soc.PutLane("high", []byte("high")))
+		soc.GetInChannel() <- []byte("low")
+	}
+
+	// the select of Publisher, msg taken from 'in' channel waits for the turn of DefaultLane
+	counts := map[string]int{}
+	for i := 0; i < 8; {
+		select {
+		case b := <-soc.inChannel():
+			soc.take(b)
+			assert.True(soc.lanes.held())
+			assert.Nil(soc.inChannel())
+		case <-soc.lanes.ready:
+			if b, ok := soc.lanes.next(); ok {
+				counts[string(b)]++
+				i++
+			}
+		}
+	}
+
+	assert.Equal(counts["high"], 6)
+	assert.Equal(counts["low"], 2)
+	assert.Equal(soc.GetLaneStats()[1].Sent, uint64(2))
+}
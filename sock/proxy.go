@@ -0,0 +1,253 @@
+package sock
+
+import (
+	"context"
+	"fmt"
+	"github.com/lafrinte/nops/atom"
+	"github.com/lafrinte/nops/timer"
+	"github.com/zeromq/goczmq"
+	"time"
+)
+
+/*
+Proxy forwards msg between a frontend and a backend Sock in one thread, like zmq_proxy_steerable.
+
+	supported pairs: XSUB -> XPUB, PULL -> PUSH, ROUTER -> DEALER
+	XSUB/XPUB and ROUTER/DEALER forward in both direction, subscriptions and replies flow back to frontend
+
+every msg forwarded is copied to the optional capture socket (PUB/PUSH). frontend, backend and capture are
+created by New with any option, msg counters are kept on each of them. control funcs of them, e.g. Ready and
+AddEndpoint, are served between polls.
+
+	capture never blocks forwarding, its send does not wait and msg capture can not take is dropped
+*/
+type Proxy struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	frontend *Sock
+	backend  *Sock
+	capture  *Sock
+
+	paused atom.AtomicBool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// NewProxy creates a Proxy, capture is optional and can be nil. Proxy exits when ctx of frontend is done
+func NewProxy(frontend, backend, capture *Sock) *Proxy {
+	switch {
+	case frontend.Type == goczmq.XSub && backend.Type == goczmq.XPub:
+	case frontend.Type == goczmq.Pull && backend.Type == goczmq.Push:
+	case frontend.Type == goczmq.Router && backend.Type == goczmq.Dealer:
+	default:
+		panic(fmt.Errorf("proxy only enables by 'type' pairs: XSub/XPub, Pull/Push, Router/Dealer"))
+	}
+
+	if capture != nil {
+		switch capture.Type {
+		case goczmq.Pub, goczmq.Push:
+		default:
+			panic(fmt.Errorf("proxy capture only enables by 'type': Pub/Push"))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(frontend.ctx)
+
+	return &Proxy{
+		ctx:      ctx,
+		cancel:   cancel,
+		frontend: frontend,
+		backend:  backend,
+		capture:  capture,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// GetFrontend gets the frontend Sock
+func (p *Proxy) GetFrontend() *Sock {
+	return p.frontend
+}
+
+// GetBackend gets the backend Sock
+func (p *Proxy) GetBackend() *Sock {
+	return p.backend
+}
+
+// GetCapture gets the capture Sock, nil when no capture
+func (p *Proxy) GetCapture() *Sock {
+	return p.capture
+}
+
+// Pause stops forwarding, msg is kept in zeromq queue until Resume
+func (p *Proxy) Pause() {
+	p.paused.Set(true)
+}
+
+// Resume restarts forwarding after Pause
+func (p *Proxy) Resume() {
+	p.paused.Set(false)
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// IsPaused reports whether the proxy is paused
+func (p *Proxy) IsPaused() bool {
+	return p.paused.True()
+}
+
+// Terminate stops the proxy and waits ExitWaitTimeout of frontend for all sockets released
+func (p *Proxy) Terminate() error {
+	p.cancel()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(p.frontend.ExitWaitTimeout):
+		return ErrExitWaitTimeout
+	}
+}
+
+// attach attaches all sockets of proxy
+func (p *Proxy) attach() error {
+	for _, s := range []*Sock{p.frontend, p.backend, p.capture} {
+		if s == nil {
+			continue
+		}
+
+		if _, err := s.Attach(); err != nil {
+			return err
+		}
+	}
+
+	if p.capture != nil {
+		p.capture.soc.SetSndtimeo(0)
+	}
+
+	return nil
+}
+
+// serve runs the control funcs queued on sockets of proxy without blocking
+func (p *Proxy) serve() {
+	for _, s := range []*Sock{p.frontend, p.backend, p.capture} {
+		if s == nil {
+			continue
+		}
+
+		for queued := true; queued; {
+			select {
+			case f := <-s.ctl:
+				f(s.soc)
+			default:
+				queued = false
+			}
+		}
+	}
+}
+
+// release releases all sockets of proxy
+func (p *Proxy) release() {
+	for _, s := range []*Sock{p.frontend, p.backend, p.capture} {
+		if s != nil {
+			s.release()
+		}
+	}
+}
+
+// forward receives one msg on 'from' and sends it to 'to' and capture
+func (p *Proxy) forward(from, to *Sock) {
+	frames, err := from.recv(from.soc)
+	if err != nil {
+		if err == goczmq.ErrRecvFrameAfterDestroy {
+			log.Error().Err(err).Msg("call RecvFrame after sock been destroyed")
+			panic(err)
+		}
+
+		log.Error().Err(err).Str("endpoint", from.Endpoint).Msg("proxy RecvMessage failed")
+		return
+	}
+
+	from.recvMsgCount.Add(1)
+
+	if err := to.send(to.soc, frames); err != nil {
+		to.dropMsgCount.Add(1)
+		log.Error().Err(err).Str("endpoint", to.Endpoint).Msg("proxy failed to forward msg, drop it")
+		return
+	}
+
+	to.sendMsgCount.Add(1)
+
+	if p.capture == nil {
+		return
+	}
+
+	if err := p.capture.send(p.capture.soc, frames); err != nil {
+		p.capture.dropMsgCount.Add(1)
+		log.Error().Err(err).Str("endpoint", p.capture.Endpoint).Msg("proxy failed to capture msg")
+		return
+	}
+
+	p.capture.sendMsgCount.Add(1)
+}
+
+// Run attaches all sockets and forwards msg until Terminate or ctx of frontend done
+func (p *Proxy) Run() {
+	defer close(p.done)
+	defer p.release()
+
+	if err := p.attach(); err != nil {
+		log.Panic().Err(err).Msg("panic on socket Attach")
+		panic(err)
+	}
+
+	poller, err := goczmq.NewPoller(p.frontend.soc)
+	if err != nil {
+		log.Panic().Err(err).Msg("panic on create poller")
+		panic(err)
+	}
+
+	defer poller.Destroy()
+
+	// PUSH backend is never readable
+	if p.backend.Type != goczmq.Push {
+		if err := poller.Add(p.backend.soc); err != nil {
+			log.Panic().Err(err).Msg("panic on add backend into poller")
+			panic(err)
+		}
+	}
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		default:
+		}
+
+		p.serve()
+
+		if p.paused.True() {
+			t := timer.AcquireTimer(time.Duration(DefaultPollTimeoutMillSec) * time.Millisecond)
+
+			select {
+			case <-p.ctx.Done():
+			case <-p.wake:
+			case <-t.C:
+			}
+
+			timer.ReleaseTimer(t)
+
+			continue
+		}
+
+		switch poller.Wait(DefaultPollTimeoutMillSec) {
+		case p.frontend.soc:
+			p.forward(p.frontend, p.backend)
+		case p.backend.soc:
+			p.forward(p.backend, p.frontend)
+		}
+	}
+}
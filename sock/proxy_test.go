@@ -0,0 +1,41 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewProxy(t *testing.T) {
+	assert := A.New(t)
+
+	p := NewProxy(
+		New(WithType("XSUB"), WithEndpoint("inproc://proxy-front")),
+		New(WithType("XPUB"), WithEndpoint("inproc://proxy-back")),
+		nil,
+	)
+
+	assert.Nil(p.GetCapture())
+	assert.False(p.IsPaused())
+
+	p.Pause()
+	assert.True(p.IsPaused())
+
+	p.Resume()
+	assert.False(p.IsPaused())
+
+	assert.Panics(func() {
+		NewProxy(
+			New(WithType("PUSH"), WithEndpoint("inproc://proxy-front")),
+			New(WithType("PULL"), WithEndpoint("inproc://proxy-back")),
+			nil,
+		)
+	})
+
+	assert.Panics(func() {
+		NewProxy(
+			New(WithType("ROUTER"), WithEndpoint("inproc://proxy-front")),
+			New(WithType("DEALER"), WithEndpoint("inproc://proxy-back")),
+			New(WithType("SUB"), WithEndpoint("inproc://proxy-capture")),
+		)
+	})
+}
@@ -0,0 +1,340 @@
+package sock
+
+import (
+	"errors"
+	"github.com/rs/xid"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy is the policy applied when Publisher sends faster than the rate limit
+type RateLimitPolicy uint8
+
+const (
+	// RateLimitWait holds msg until tokens are enough, it is the default policy. Publisher reads no more msg
+	// while a msg is held but keeps serving the others, msg held on exit goes to spool or dead letter
+	RateLimitWait RateLimitPolicy = iota
+	// RateLimitDrop drops msg into dead letter when tokens are not enough
+	RateLimitDrop
+)
+
+// DefaultRateWindow is the window of measuring send rate
+const DefaultRateWindow = time.Second * 5
+
+// ErrRateLimited is the error of msg dropped by RateLimitDrop
+var ErrRateLimited = errors.New("rate limited")
+
+// tokenBucket refills rate tokens per second up to burst
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	b.last = now
+}
+
+// available reports whether n tokens can be taken, n larger than burst only needs a full bucket
+func (b *tokenBucket) available(n float64) bool {
+	if n > b.burst {
+		n = b.burst
+	}
+
+	return b.tokens >= n
+}
+
+// delay gets the time before tokens are not negative
+func (b *tokenBucket) delay() time.Duration {
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimiter limits msg and bytes of Publisher by token buckets, nil bucket is not limited
+type rateLimiter struct {
+	mu     sync.Mutex
+	msgs   *tokenBucket
+	bytes  *tokenBucket
+	policy RateLimitPolicy
+
+	// msg waiting for its tokens by RateLimitWait, it is sent when timer fires
+	head    []byte
+	holding bool
+	timer   *time.Timer
+}
+
+func newRateLimiter() *rateLimiter {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+
+	return &rateLimiter{timer: t}
+}
+
+func (l *rateLimiter) enabled() bool {
+	return l.msgs != nil || l.bytes != nil
+}
+
+// hold keeps msg until d passed
+func (l *rateLimiter) hold(msg []byte, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.head, l.holding = msg, true
+	l.timer.Reset(d)
+}
+
+// held reports whether a msg is waiting for its tokens
+func (l *rateLimiter) held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.holding
+}
+
+// take removes the msg held, false is returned when there is none
+func (l *rateLimiter) take() ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.holding {
+		return nil, false
+	}
+
+	if !l.timer.Stop() {
+		select {
+		case <-l.timer.C:
+		default:
+		}
+	}
+
+	msg := l.head
+	l.head, l.holding = nil, false
+
+	return msg, true
+}
+
+// C fires when the msg held can be sent
+func (l *rateLimiter) C() <-chan time.Time {
+	return l.timer.C
+}
+
+// allow takes tokens of msg when all buckets have enough tokens
+func (l *rateLimiter) allow(size int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, b := range []*tokenBucket{l.msgs, l.bytes} {
+		if b != nil {
+			b.refill(now)
+		}
+	}
+
+	if l.msgs != nil && !l.msgs.available(1) {
+		return false
+	}
+
+	if l.bytes != nil && !l.bytes.available(float64(size)) {
+		return false
+	}
+
+	if l.msgs != nil {
+		l.msgs.tokens--
+	}
+
+	if l.bytes != nil {
+		l.bytes.tokens -= float64(size)
+	}
+
+	return true
+}
+
+// reserve takes tokens of msg and returns the time to wait before sending it
+func (l *rateLimiter) reserve(size int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var d time.Duration
+
+	if l.msgs != nil {
+		l.msgs.refill(now)
+		l.msgs.tokens--
+		d = l.msgs.delay()
+	}
+
+	if l.bytes != nil {
+		l.bytes.refill(now)
+		l.bytes.tokens -= float64(size)
+		if bd := l.bytes.delay(); bd > d {
+			d = bd
+		}
+	}
+
+	return d
+}
+
+// WithMsgRateLimit limits Publisher to send rate msg per second, burst msg can be sent at once
+func WithMsgRateLimit(rate float64, burst int) Option {
+	return func(s *Sock) {
+		if rate > 0 {
+			s.limiter.msgs = newTokenBucket(rate, burst)
+		}
+	}
+}
+
+// WithByteRateLimit limits Publisher to send rate bytes of msg per second, burst bytes can be sent at once
+func WithByteRateLimit(rate float64, burst int) Option {
+	return func(s *Sock) {
+		if rate > 0 {
+			s.limiter.bytes = newTokenBucket(rate, burst)
+		}
+	}
+}
+
+// WithRateLimitPolicy sets the policy applied when rate limit exceeded, RateLimitWait by default
+func WithRateLimitPolicy(policy RateLimitPolicy) Option {
+	return func(s *Sock) {
+		s.limiter.policy = policy
+	}
+}
+
+// throttle applies rate limit on msg of 'in' channel, returns false when msg is dropped or held by RateLimitWait
+func (s *Sock) throttle(msg []byte) bool {
+	if !s.limiter.enabled() {
+		return true
+	}
+
+	if s.limiter.policy == RateLimitDrop {
+		if s.limiter.allow(len(msg)) {
+			return true
+		}
+
+		s.dead(msg, ErrRateLimited, 0)
+		return false
+	}
+
+	d := s.limiter.reserve(len(msg))
+	if d <= 0 {
+		return true
+	}
+
+	// tokens are taken already, msg is sent by Publisher when timer fires
+	s.limiter.hold(msg, d)
+
+	return false
+}
+
+// sendHeld sends the msg held by RateLimitWait when its tokens are enough
+func (s *Sock) sendHeld() {
+	if msg, ok := s.limiter.take(); ok {
+		s.publish(msg)
+	}
+}
+
+// dropHeld moves the msg held by RateLimitWait into spool or dead letter, it is called on exit
+func (s *Sock) dropHeld() {
+	if msg, ok := s.limiter.take(); ok {
+		s.lost(s.wrap(msg, xid.NilID()), ErrRateLimited, 0)
+	}
+}
+
+// rateMeter measures the rate of msg and bytes in a sliding window of one second slots
+type rateMeter struct {
+	mu    sync.Mutex
+	msgs  []uint64
+	bytes []uint64
+	sec   int64
+}
+
+func newRateMeter(window time.Duration) *rateMeter {
+	slots := int(window / time.Second)
+	if slots < 1 {
+		slots = 1
+	}
+
+	// one more slot for the current second which is not complete
+	return &rateMeter{msgs: make([]uint64, slots+1), bytes: make([]uint64, slots+1)}
+}
+
+// advance clears the slots passed since last update
+func (m *rateMeter) advance(sec int64) {
+	if m.sec == 0 || sec-m.sec >= int64(len(m.msgs)) {
+		for i := range m.msgs {
+			m.msgs[i], m.bytes[i] = 0, 0
+		}
+	} else {
+		for s := m.sec + 1; s <= sec; s++ {
+			i := int(s % int64(len(m.msgs)))
+			m.msgs[i], m.bytes[i] = 0, 0
+		}
+	}
+
+	if sec > m.sec {
+		m.sec = sec
+	}
+}
+
+// mark records one msg of size bytes
+func (m *rateMeter) mark(size int) {
+	m.markAt(time.Now().Unix(), size)
+}
+
+func (m *rateMeter) markAt(sec int64, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(sec)
+
+	i := int(sec % int64(len(m.msgs)))
+	m.msgs[i]++
+	m.bytes[i] += uint64(size)
+}
+
+// rate gets msg and bytes per second of the complete slots
+func (m *rateMeter) rate() (float64, float64) {
+	return m.rateAt(time.Now().Unix())
+}
+
+func (m *rateMeter) rateAt(sec int64) (float64, float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(sec)
+
+	var msgs, bytes uint64
+	for i := range m.msgs {
+		if i == int(sec%int64(len(m.msgs))) {
+			continue
+		}
+
+		msgs += m.msgs[i]
+		bytes += m.bytes[i]
+	}
+
+	slots := float64(len(m.msgs) - 1)
+
+	return float64(msgs) / slots, float64(bytes) / slots
+}
+
+// GetSendRate gets msg and bytes sent per second in the last DefaultRateWindow
+func (s *Sock) GetSendRate() (float64, float64) {
+	return s.sendRate.rate()
+}
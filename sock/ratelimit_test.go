@@ -0,0 +1,111 @@
+package sock
+
+import (
+	A "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(
+		WithType("PUSH"),
+		WithEndpoint("inproc://ratelimit"),
+		WithMsgRateLimit(10, 5),
+		WithByteRateLimit(1000, 100),
+		WithRateLimitPolicy(RateLimitDrop),
+	)
+
+	assert.True(soc.limiter.enabled())
+
+	// burst of msg
+	for i := 0; i < 5; i++ {
+		assert.True(soc.throttle([]byte("a")))
+	}
+
+	assert.False(soc.throttle([]byte("a")))
+	assert.Equal(soc.GetDropMsgCount(), uint64(1))
+
+	// burst of bytes, msg larger than burst only needs a full bucket
+	soc = New(WithType("PUSH"), WithEndpoint("inproc://ratelimit"), WithByteRateLimit(1000, 100),
+		WithRateLimitPolicy(RateLimitDrop))
+	assert.True(soc.throttle(make([]byte, 200)))
+	assert.False(soc.throttle(make([]byte, 1)))
+
+	soc = New(WithType("PUSH"), WithEndpoint("inproc://ratelimit"), WithMsgRateLimit(100, 1))
+	assert.Equal(soc.limiter.reserve(1), time.Duration(0))
+
+	d := soc.limiter.reserve(1)
+	assert.Greater(d, time.Millisecond*5)
+	assert.LessOrEqual(d, time.Millisecond*10)
+
+	// msg is held without blocking until its tokens are enough
+	start := time.Now()
+	assert.False(soc.throttle([]byte("a")))
+	assert.True(soc.limiter.held())
+	assert.Less(time.Since(start), time.Millisecond*10)
+
+	<-soc.limiter.C()
+	assert.GreaterOrEqual(time.Since(start), time.Millisecond*10)
+
+	msg, ok := soc.limiter.take()
+	assert.True(ok)
+	assert.Equal(msg, []byte("a"))
+	assert.False(soc.limiter.held())
+
+	assert.False(New(WithType("PUSH"), WithEndpoint("inproc://ratelimit")).limiter.enabled())
+}
+
+func TestRateLimitHeldOnExit(t *testing.T) {
+	assert := A.New(t)
+
+	ch := NewDeadLetterChan(1)
+	soc := New(
+		WithType("PUSH"),
+		WithEndpoint("inproc://ratelimit"),
+		WithMsgRateLimit(1, 1),
+		WithDeadLetter(ch),
+		WithEnvelope(),
+	)
+
+	assert.True(soc.throttle([]byte("a")))
+	assert.False(soc.throttle([]byte("b")))
+
+	// msg held is dead lettered as it is on the wire
+	soc.dropHeld()
+	assert.False(soc.limiter.held())
+
+	dead := <-ch
+	assert.Equal(dead.Err, ErrRateLimited)
+
+	e, err := ParseEnvelope(dead.Msg)
+	assert.Nil(err)
+	assert.Equal(e.Body, []byte("b"))
+}
+
+func TestRateMeter(t *testing.T) {
+	assert := A.New(t)
+
+	m := newRateMeter(time.Second * 2)
+
+	for i := 0; i < 10; i++ {
+		m.markAt(100, 10)
+	}
+
+	// current second is not complete
+	msgs, bytes := m.rateAt(100)
+	assert.Equal(msgs, float64(0))
+	assert.Equal(bytes, float64(0))
+
+	m.markAt(101, 10)
+	msgs, bytes = m.rateAt(101)
+	assert.Equal(msgs, float64(5))
+	assert.Equal(bytes, float64(50))
+
+	msgs, _ = m.rateAt(102)
+	assert.Equal(msgs, 5.5)
+
+	msgs, _ = m.rateAt(110)
+	assert.Equal(msgs, float64(0))
+}
@@ -0,0 +1,73 @@
+package sock
+
+import (
+	"fmt"
+	"github.com/zeromq/goczmq"
+)
+
+// MaxIdentitySize is the max length of a zeromq routing id
+const MaxIdentitySize = 255
+
+/*
+NewRouteMsg packs the peer identity and msg into one buffer, it is the format of msg in 'in' and 'out'
+channel of a ROUTER socket.
+
+	| 1 byte identity length | identity | msg |
+*/
+func NewRouteMsg(identity []byte, msg []byte) []byte {
+	if len(identity) == 0 || len(identity) > MaxIdentitySize {
+		panic(fmt.Errorf("identity length must be in [1, %d], got %d", MaxIdentitySize, len(identity)))
+	}
+
+	buf := make([]byte, 0, 1+len(identity)+len(msg))
+	buf = append(buf, byte(len(identity)))
+	buf = append(buf, identity...)
+	buf = append(buf, msg...)
+
+	return buf
+}
+
+// SplitRouteMsg unpacks the buffer created by NewRouteMsg into peer identity and msg
+func SplitRouteMsg(buf []byte) ([]byte, []byte, error) {
+	if len(buf) == 0 {
+		return nil, nil, fmt.Errorf("empty route msg")
+	}
+
+	size := int(buf[0])
+	if size == 0 || len(buf) < 1+size {
+		return nil, nil, fmt.Errorf("malformed route msg: identity length %d, buffer length %d", size, len(buf))
+	}
+
+	return buf[1 : 1+size], buf[1+size:], nil
+}
+
+/*
+Router receives msg from peers and charges into 'out' channel with peer identity, and routes msg in 'in'
+channel back to the peer. optional socket type: ROUTER
+
+	msg in 'in' and 'out' channel is packed by NewRouteMsg, use SplitRouteMsg to get the identity
+*/
+func (s *Sock) Router() {
+	switch s.Type {
+	case goczmq.Router:
+	default:
+		panic(fmt.Errorf("router only enables by 'type': Router"))
+	}
+
+	defer s.recovery(s.Router)
+
+	s.duplex("Router")
+}
+
+// Dealer sends msg in 'in' channel and receives msg into 'out' channel asynchronously. optional socket type: DEALER
+func (s *Sock) Dealer() {
+	switch s.Type {
+	case goczmq.Dealer:
+	default:
+		panic(fmt.Errorf("dealer only enables by 'type': Dealer"))
+	}
+
+	defer s.recovery(s.Dealer)
+
+	s.duplex("Dealer")
+}
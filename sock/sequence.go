@@ -0,0 +1,459 @@
+package sock
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// SequenceHeader is the Envelope header of the sequence number set by WithSequence
+	SequenceHeader = "nops-seq"
+	// SequenceEpochHeader is the Envelope header of the run of producer set by WithSequence, sequence number starts
+	// from 1 again in every run
+	SequenceEpochHeader = "nops-epoch"
+
+	DefaultDedupeWindow = 1024
+	// DefaultDedupeIdle is the time the window of a producer sending nothing is kept
+	DefaultDedupeIdle = time.Minute * 10
+)
+
+// Sequence gets the sequence number of msg set by WithSequence, false is returned when msg has none
+func (e *Envelope) Sequence() (uint64, bool) {
+	val, ok := e.Headers[SequenceHeader]
+	if !ok {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(val, 10, 64)
+	if err != nil || seq == 0 {
+		return 0, false
+	}
+
+	return seq, true
+}
+
+// Epoch gets the run of producer set by WithSequence, 0 is returned when msg has none
+func (e *Envelope) Epoch() uint64 {
+	epoch, err := strconv.ParseUint(e.Headers[SequenceEpochHeader], 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return epoch
+}
+
+/*
+WithSequence numbers every msg sent from 1 in the Envelope header SequenceHeader, Envelope is enabled with it.
+the number is per ProducerID and kept on retry, so consumer created by WithDedupe drops the msg delivered twice.
+
+	ProducerID must be uniq for every running socket, the ID of Sock used by default is uniq. a stable ProducerID
+	may be kept across restarts of process, the time socket is created is sent as SequenceEpochHeader, so consumer
+	starts a new window for the new run instead of dropping its msg as duplicates. clocks of producer hosts should
+	not go backwards between runs
+*/
+func WithSequence() Option {
+	return func(s *Sock) {
+		s.envelope = true
+		s.sequence = true
+		s.epoch = uint64(time.Now().UnixNano())
+	}
+}
+
+// GapHandler is called with the range [from, to] of sequence numbers never received from producer, it is called in
+// the thread of socket and should not block
+type GapHandler func(producer string, from, to uint64)
+
+/*
+WithDedupe drops msg received whose sequence number has been received from the same producer, Envelope is
+enabled with it. window is the count of sequence numbers tracked behind the highest one, msg older than window
+is dropped as duplicate, and the sequence numbers never received in the window are reported to handler as gap.
+
+	msg without sequence number is passed through. handler may be nil. the window of producer sending nothing for
+	DefaultDedupeIdle is dropped, so the windows of producers gone do not pile up. with WithAckConnect, duplicate
+	dropped is acked again, since it is a redelivery whose ack is lost
+*/
+func WithDedupe(window int, handler GapHandler) Option {
+	return func(s *Sock) {
+		if window <= 0 {
+			window = DefaultDedupeWindow
+		}
+
+		s.envelope = true
+		s.dedupe.window = uint64(window)
+		s.dedupe.handler = handler
+	}
+}
+
+/*
+WithReorder holds msg received out of order until the msg before it arrives, so msg of every producer is put
+into 'out' channel in sequence order. a msg is held no longer than delay, then the missing ones are given up as
+gap. it enables WithDedupe with DefaultDedupeWindow when it is not set.
+
+	the first msg received from a producer is held for delay unless its sequence number is 1, so the msg before it
+	arriving later are not dropped
+*/
+func WithReorder(delay time.Duration) Option {
+	return func(s *Sock) {
+		if s.dedupe.window == 0 {
+			s.envelope = true
+			s.dedupe.window = DefaultDedupeWindow
+		}
+
+		s.dedupe.delay = delay
+	}
+}
+
+// heldMsg is a msg held by reorder buffer
+type heldMsg struct {
+	msg     []byte
+	arrival time.Time
+}
+
+// seqWindow tracks sequence numbers of one run of producer, all sequence numbers not above base are done
+type seqWindow struct {
+	epoch uint64
+	base  uint64
+	// base is lowered by msg arriving before the first one until it is anchored, it is anchored at once without
+	// reorder
+	anchored bool
+	// last time msg is received
+	last time.Time
+	// sequence numbers above base delivered without reorder
+	seen map[uint64]struct{}
+	// msg above base held by reorder buffer
+	held map[uint64]heldMsg
+}
+
+// sequencer deduplicates and reorders msg by sequence number, it is only used in the thread owning socket
+type sequencer struct {
+	window  uint64
+	delay   time.Duration
+	handler GapHandler
+
+	producers map[string]*seqWindow
+	timer     *time.Timer
+
+	// windows idle longer than idle are removed, at most once in idle
+	idle  time.Duration
+	swept time.Time
+
+	dups atomic.Uint64
+	gaps atomic.Uint64
+}
+
+func newSequencer() *sequencer {
+	t := time.NewTimer(time.Hour)
+	t.Stop()
+
+	return &sequencer{producers: make(map[string]*seqWindow), timer: t, idle: DefaultDedupeIdle}
+}
+
+// enabled reports whether msg received is deduplicated
+func (q *sequencer) enabled() bool {
+	return q.window > 0
+}
+
+// reorder reports whether msg received is reordered
+func (q *sequencer) reorder() bool {
+	return q.delay > 0
+}
+
+// accept takes msg with seq in epoch of producer, returns msg to deliver in order
+func (q *sequencer) accept(producer string, epoch, seq uint64, msg []byte, now time.Time) [][]byte {
+	q.sweep(now)
+
+	var out [][]byte
+
+	w, ok := q.producers[producer]
+	if ok && epoch != w.epoch {
+		// msg of the previous run of producer arrives late
+		if epoch < w.epoch {
+			q.dups.Add(1)
+			return nil
+		}
+
+		// producer restarted, msg held of the previous run go first
+		out = append(out, q.release(producer, w)...)
+		ok = false
+	}
+
+	if !ok {
+		w = &seqWindow{
+			epoch:    epoch,
+			base:     seq - 1,
+			anchored: !q.reorder() || seq == 1,
+			seen:     make(map[uint64]struct{}),
+			held:     make(map[uint64]heldMsg),
+		}
+		q.producers[producer] = w
+	}
+
+	w.last = now
+
+	if _, held := w.held[seq]; !held && !w.anchored && seq <= w.base && w.base-seq < q.window {
+		w.base = seq - 1
+	}
+
+	_, seen := w.seen[seq]
+	_, held := w.held[seq]
+	if seq <= w.base || seen || held {
+		q.dups.Add(1)
+		return out
+	}
+
+	if q.reorder() {
+		w.held[seq] = heldMsg{msg: msg, arrival: now}
+	} else {
+		w.seen[seq] = struct{}{}
+		out = append(out, msg)
+	}
+
+	if seq-w.base > q.window {
+		w.anchored = true
+		out = append(out, q.skip(producer, w, seq-q.window)...)
+	}
+
+	if w.anchored {
+		out = append(out, q.advance(w)...)
+	}
+
+	if q.reorder() {
+		q.schedule()
+	}
+
+	return out
+}
+
+// advance moves base over the contiguous sequence numbers, returns msg held on them
+func (q *sequencer) advance(w *seqWindow) [][]byte {
+	var out [][]byte
+	for {
+		next := w.base + 1
+		if h, ok := w.held[next]; ok {
+			out = append(out, h.msg)
+			delete(w.held, next)
+		} else if _, ok := w.seen[next]; ok {
+			delete(w.seen, next)
+		} else {
+			return out
+		}
+
+		w.base = next
+	}
+}
+
+// skip moves base to 'to', the sequence numbers never received are reported as gap, returns msg held on the way
+func (q *sequencer) skip(producer string, w *seqWindow, to uint64) [][]byte {
+	var out [][]byte
+	var from uint64
+
+	// sequence numbers tracked are never beyond base + window
+	last := to
+	if last-w.base > q.window {
+		last = w.base + q.window
+	}
+
+	for seq := w.base + 1; seq <= last; seq++ {
+		h, held := w.held[seq]
+		_, seen := w.seen[seq]
+
+		if !held && !seen {
+			if from == 0 {
+				from = seq
+			}
+
+			continue
+		}
+
+		if from != 0 {
+			q.gap(producer, from, seq-1)
+			from = 0
+		}
+
+		if held {
+			out = append(out, h.msg)
+			delete(w.held, seq)
+		} else {
+			delete(w.seen, seq)
+		}
+	}
+
+	if from == 0 && last < to {
+		from = last + 1
+	}
+
+	if from != 0 {
+		q.gap(producer, from, to)
+	}
+
+	w.base = to
+
+	return out
+}
+
+func (q *sequencer) gap(producer string, from, to uint64) {
+	q.gaps.Add(to - from + 1)
+
+	if q.handler != nil {
+		q.handler(producer, from, to)
+	}
+}
+
+// expire gives up the gaps before msg held longer than delay, returns msg to deliver in order
+func (q *sequencer) expire(now time.Time) [][]byte {
+	var out [][]byte
+	for producer, w := range q.producers {
+		for len(w.held) > 0 {
+			oldest, lowest := now, uint64(0)
+			for seq, h := range w.held {
+				if h.arrival.Before(oldest) {
+					oldest = h.arrival
+				}
+
+				if lowest == 0 || seq < lowest {
+					lowest = seq
+				}
+			}
+
+			if now.Sub(oldest) < q.delay {
+				break
+			}
+
+			w.anchored = true
+			out = append(out, q.skip(producer, w, lowest-1)...)
+			out = append(out, q.advance(w)...)
+		}
+	}
+
+	q.schedule()
+
+	return out
+}
+
+// flush gives up all gaps and returns all msg held, it is called on release
+func (q *sequencer) flush() [][]byte {
+	var out [][]byte
+	for producer, w := range q.producers {
+		out = append(out, q.release(producer, w)...)
+	}
+
+	return out
+}
+
+// release gives up all gaps of window and returns all msg held in it
+func (q *sequencer) release(producer string, w *seqWindow) [][]byte {
+	var out [][]byte
+	for len(w.held) > 0 {
+		lowest := uint64(0)
+		for seq := range w.held {
+			if lowest == 0 || seq < lowest {
+				lowest = seq
+			}
+		}
+
+		out = append(out, q.skip(producer, w, lowest-1)...)
+		out = append(out, q.advance(w)...)
+	}
+
+	w.anchored = true
+
+	return out
+}
+
+// sweep removes the windows of producers idle longer than idle, msg of them arriving later starts a new window
+func (q *sequencer) sweep(now time.Time) {
+	if q.idle <= 0 || now.Sub(q.swept) < q.idle {
+		return
+	}
+
+	q.swept = now
+
+	for producer, w := range q.producers {
+		if len(w.held) == 0 && now.Sub(w.last) >= q.idle {
+			delete(q.producers, producer)
+		}
+	}
+}
+
+// schedule resets timer to the time the oldest msg held expires
+func (q *sequencer) schedule() {
+	if !q.timer.Stop() {
+		select {
+		case <-q.timer.C:
+		default:
+		}
+	}
+
+	var oldest time.Time
+	for _, w := range q.producers {
+		for _, h := range w.held {
+			if oldest.IsZero() || h.arrival.Before(oldest) {
+				oldest = h.arrival
+			}
+		}
+	}
+
+	if !oldest.IsZero() {
+		q.timer.Reset(time.Until(oldest.Add(q.delay)))
+	}
+}
+
+// C fires when msg held by reorder buffer expires
+func (q *sequencer) C() <-chan time.Time {
+	return q.timer.C
+}
+
+// Held gets the count of msg held by reorder buffer
+func (q *sequencer) Held() int {
+	n := 0
+	for _, w := range q.producers {
+		n += len(w.held)
+	}
+
+	return n
+}
+
+// GetDupMsgCount gets the count of duplicate msg dropped by WithDedupe
+func (s *Sock) GetDupMsgCount() uint64 {
+	return s.dedupe.dups.Load()
+}
+
+// GetGapMsgCount gets the count of msg never received reported as gap by WithDedupe
+func (s *Sock) GetGapMsgCount() uint64 {
+	return s.dedupe.gaps.Load()
+}
+
+// deliver puts msg received into 'out' channel, it is deduplicated and reordered by sequence number when enabled
+func (s *Sock) deliver(msg []byte) {
+	msgs := [][]byte{msg}
+
+	if s.dedupe.enabled() {
+		if e, err := s.unwrap(msg); err == nil {
+			if seq, ok := e.Sequence(); ok {
+				dups := s.dedupe.dups.Load()
+				msgs = s.dedupe.accept(e.ProducerID, e.Epoch(), seq, msg, time.Now())
+
+				// duplicate is a redelivery whose ack is lost, it is acked again so producer stops redelivering it
+				if s.dedupe.dups.Load() > dups && s.acks.link != nil && !s.acks.tracking() {
+					if err := s.Ack(msg); err != nil {
+						log.Warn().Err(err).Msg("failed to ack duplicate msg")
+					}
+				}
+			}
+		}
+	}
+
+	s.put(msgs)
+}
+
+// put puts msgs into 'out' channel by the overflow policy
+func (s *Sock) put(msgs [][]byte) {
+	for _, msg := range msgs {
+		s.recvMsgCount.Add(1)
+
+		if err := s.outOverflow.put(s.ctx, s.done, s.out, msg, s.dropped); err != nil {
+			log.Warn().Err(err).Msg("out buffer overflow, drop received msg")
+		}
+	}
+}
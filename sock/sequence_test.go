@@ -0,0 +1,218 @@
+package sock
+
+import (
+	"github.com/rs/xid"
+	A "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func seqMsgs(msgs [][]byte) []string {
+	var got []string
+	for _, msg := range msgs {
+		got = append(got, string(msg))
+	}
+
+	return got
+}
+
+func TestSequenceHeader(t *testing.T) {
+	assert := A.New(t)
+
+	soc := New(WithType("Push"), WithEndpoint("inproc://seq"), WithSequence())
+	assert.True(soc.envelope)
+
+	for i := 1; i <= 3; i++ {
+		e, err := ParseEnvelope(soc.wrap([]byte("a"), xid.NilID()))
+		assert.Nil(err)
+
+		seq, ok := e.Sequence()
+		assert.True(ok)
+		assert.Equal(seq, uint64(i))
+		assert.Equal(e.ProducerID, soc.GetID())
+		assert.Equal(e.Epoch(), soc.epoch)
+	}
+
+	assert.NotZero(soc.epoch)
+
+	_, ok := NewEnvelope([]byte("a")).Sequence()
+	assert.False(ok)
+}
+
+func TestDedupe(t *testing.T) {
+	assert := A.New(t)
+
+	var gaps [][2]uint64
+	q := newSequencer()
+	q.window = 4
+	q.handler = func(producer string, from, to uint64) {
+		assert.Equal(producer, "p")
+		gaps = append(gaps, [2]uint64{from, to})
+	}
+
+	now := time.Now()
+	assert.Equal(seqMsgs(q.accept("p", 0, 10, []byte("10"), now)), []string{"10"})
+	assert.Nil(q.accept("p", 0, 10, []byte("10"), now))
+	assert.Equal(seqMsgs(q.accept("p", 0, 12, []byte("12"), now)), []string{"12"})
+	assert.Equal(seqMsgs(q.accept("p", 0, 11, []byte("11"), now)), []string{"11"})
+	assert.Nil(q.accept("p", 0, 12, []byte("12"), now))
+	assert.Equal(q.dups.Load(), uint64(2))
+
+	// 13 and 14 fall out of window
+	assert.Equal(seqMsgs(q.accept("p", 0, 19, []byte("19"), now)), []string{"19"})
+	assert.Equal(gaps, [][2]uint64{{13, 15}})
+	assert.Equal(q.gaps.Load(), uint64(3))
+	assert.Nil(q.accept("p", 0, 14, []byte("14"), now))
+
+	// other producer has its own window
+	assert.Equal(seqMsgs(q.accept("q", 0, 1, []byte("1"), now)), []string{"1"})
+
+	// jump far beyond window
+	gaps = nil
+	assert.Equal(seqMsgs(q.accept("p", 0, 100, []byte("100"), now)), []string{"100"})
+	assert.Equal(gaps, [][2]uint64{{16, 18}, {20, 96}})
+}
+
+func TestReorder(t *testing.T) {
+	assert := A.New(t)
+
+	var gaps [][2]uint64
+	q := newSequencer()
+	q.window = 100
+	q.delay = time.Millisecond * 50
+	q.handler = func(_ string, from, to uint64) {
+		gaps = append(gaps, [2]uint64{from, to})
+	}
+
+	now := time.Now()
+	assert.Equal(seqMsgs(q.accept("p", 0, 1, []byte("1"), now)), []string{"1"})
+	assert.Nil(q.accept("p", 0, 3, []byte("3"), now))
+	assert.Nil(q.accept("p", 0, 4, []byte("4"), now))
+	assert.Nil(q.accept("p", 0, 3, []byte("3"), now))
+	assert.Equal(q.Held(), 2)
+
+	assert.Equal(seqMsgs(q.accept("p", 0, 2, []byte("2"), now)), []string{"2", "3", "4"})
+	assert.Equal(q.Held(), 0)
+
+	assert.Nil(q.accept("p", 0, 7, []byte("7"), now))
+	assert.Nil(q.accept("p", 0, 9, []byte("9"), now.Add(time.Millisecond*40)))
+
+	// held no longer than delay
+	assert.Nil(q.expire(now.Add(time.Millisecond * 40)))
+	assert.Equal(seqMsgs(q.expire(now.Add(time.Millisecond*50))), []string{"7"})
+	assert.Equal(gaps, [][2]uint64{{5, 6}})
+
+	select {
+	case <-q.C():
+	case <-time.After(time.Second):
+		assert.Fail("reorder timer not fired")
+	}
+
+	assert.Equal(seqMsgs(q.expire(now.Add(time.Millisecond*90))), []string{"9"})
+	assert.Equal(gaps, [][2]uint64{{5, 6}, {8, 8}})
+
+	assert.Nil(q.accept("p", 0, 12, []byte("12"), now))
+	assert.Nil(q.accept("p", 0, 11, []byte("11"), now))
+	assert.Equal(seqMsgs(q.flush()), []string{"11", "12"})
+	assert.Equal(q.gaps.Load(), uint64(4))
+}
+
+func TestDedupeEpoch(t *testing.T) {
+	assert := A.New(t)
+
+	var gaps [][2]uint64
+	q := newSequencer()
+	q.window = 100
+	q.delay = time.Millisecond * 50
+	q.handler = func(_ string, from, to uint64) {
+		gaps = append(gaps, [2]uint64{from, to})
+	}
+
+	now := time.Now()
+	assert.Equal(seqMsgs(q.accept("p", 1, 1, []byte("1"), now)), []string{"1"})
+	assert.Nil(q.accept("p", 1, 3, []byte("3"), now))
+
+	// producer restarted, msg held of the previous run go first
+	assert.Equal(seqMsgs(q.accept("p", 2, 1, []byte("new 1"), now)), []string{"3", "new 1"})
+	assert.Equal(gaps, [][2]uint64{{2, 2}})
+	assert.Equal(q.dups.Load(), uint64(0))
+
+	// msg of the previous run arriving late is duplicate
+	assert.Nil(q.accept("p", 1, 4, []byte("4"), now))
+	assert.Equal(seqMsgs(q.accept("p", 2, 2, []byte("new 2"), now)), []string{"new 2"})
+	assert.Equal(q.dups.Load(), uint64(1))
+}
+
+func TestReorderFirst(t *testing.T) {
+	assert := A.New(t)
+
+	var gaps [][2]uint64
+	q := newSequencer()
+	q.window = 100
+	q.delay = time.Millisecond * 50
+	q.handler = func(_ string, from, to uint64) {
+		gaps = append(gaps, [2]uint64{from, to})
+	}
+
+	// the first msg received is not the lowest, it is held until delay
+	now := time.Now()
+	assert.Nil(q.accept("p", 0, 12, []byte("12"), now))
+	assert.Nil(q.accept("p", 0, 10, []byte("10"), now))
+	assert.Nil(q.accept("p", 0, 11, []byte("11"), now))
+	assert.Nil(q.accept("p", 0, 10, []byte("10"), now))
+	assert.Equal(q.Held(), 3)
+	assert.Equal(q.dups.Load(), uint64(1))
+
+	assert.Nil(q.expire(now.Add(time.Millisecond * 40)))
+	assert.Equal(seqMsgs(q.expire(now.Add(time.Millisecond*50))), []string{"10", "11", "12"})
+	assert.Nil(gaps)
+
+	// window is anchored, msg before it is duplicate
+	assert.Nil(q.accept("p", 0, 9, []byte("9"), now))
+	assert.Equal(seqMsgs(q.accept("p", 0, 13, []byte("13"), now)), []string{"13"})
+	assert.Equal(q.dups.Load(), uint64(2))
+}
+
+func TestDedupeIdle(t *testing.T) {
+	assert := A.New(t)
+
+	q := newSequencer()
+	q.window = 100
+	q.idle = time.Minute
+
+	now := time.Now()
+	assert.Equal(seqMsgs(q.accept("p", 0, 1, []byte("1"), now)), []string{"1"})
+	assert.Equal(seqMsgs(q.accept("q", 0, 1, []byte("1"), now.Add(time.Second*50))), []string{"1"})
+	assert.Len(q.producers, 2)
+
+	// window of p is idle for idle, q is not
+	assert.Equal(seqMsgs(q.accept("q", 0, 2, []byte("2"), now.Add(time.Minute))), []string{"2"})
+	assert.Len(q.producers, 1)
+	assert.Contains(q.producers, "q")
+
+	// swept at most once in idle
+	assert.Equal(seqMsgs(q.accept("r", 0, 1, []byte("1"), now.Add(time.Second*90))), []string{"1"})
+	assert.Len(q.producers, 2)
+}
+
+func TestDedupeDeliver(t *testing.T) {
+	assert := A.New(t)
+
+	producer := New(WithType("Push"), WithEndpoint("inproc://seq"), WithSequence())
+	consumer := New(WithType("Pull"), WithEndpoint("inproc://seq"), WithMaxBufferSize(10), WithDedupe(0, nil))
+
+	assert.Equal(consumer.dedupe.window, uint64(DefaultDedupeWindow))
+
+	msg := producer.wrap([]byte("a"), xid.NilID())
+	consumer.deliver(msg)
+	consumer.deliver(msg)
+	consumer.deliver(producer.wrap([]byte("b"), xid.NilID()))
+
+	// msg without sequence number is passed through
+	consumer.deliver(NewEnvelope([]byte("c")).Bytes())
+
+	assert.Equal(consumer.GetOutCount(), 3)
+	assert.Equal(consumer.GetRecvMsgCount(), uint64(3))
+	assert.Equal(consumer.GetDupMsgCount(), uint64(1))
+	assert.Equal(consumer.GetGapMsgCount(), uint64(0))
+}
@@ -0,0 +1,170 @@
+package sock
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/xid"
+	"time"
+)
+
+const (
+	DefaultHandlerTimeout = time.Second * 3
+
+	replyOK    byte = 0
+	replyError byte = 1
+)
+
+// Handler handles one request and returns its reply, ctx is done when the request timeout
+type Handler func(ctx context.Context, req []byte) ([]byte, error)
+
+// RemoteError is the error returned by the Handler of Server
+type RemoteError struct {
+	Msg string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Msg
+}
+
+/*
+NewReply packs the result of Handler into reply envelope
+
+	| 1 byte status, 0: ok, 1: error | reply msg or error msg |
+*/
+func NewReply(body []byte, err error) []byte {
+	if err != nil {
+		return append([]byte{replyError}, err.Error()...)
+	}
+
+	return append([]byte{replyOK}, body...)
+}
+
+// ParseReply unpacks the reply envelope created by NewReply, error of Handler is returned as *RemoteError
+func ParseReply(buf []byte) ([]byte, error) {
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	switch buf[0] {
+	case replyOK:
+		return buf[1:], nil
+	case replyError:
+		return nil, &RemoteError{Msg: string(buf[1:])}
+	default:
+		return nil, fmt.Errorf("malformed reply: unknown status %d", buf[0])
+	}
+}
+
+/*
+Server is a concurrent request/reply server on ROUTER socket. every request is dispatched onto Pool and
+handled by Handler within timeout, the reply envelope created by NewReply is routed back to the client.
+
+	REQ and DEALER clients are supported, use ParseReply to unpack the reply. with WithEnvelope, Handler gets the
+	Body of request and reply is wrapped with the ID of request as CorrelationID
+*/
+type Server struct {
+	s       *Sock
+	handler Handler
+	timeout time.Duration
+}
+
+// NewServer creates a Server, socket type is always ROUTER with multipart enabled
+func NewServer(handler Handler, timeout time.Duration, opts ...Option) *Server {
+	if timeout <= 0 {
+		timeout = DefaultHandlerTimeout
+	}
+
+	opts = append(opts, WithType("ROUTER"), WithMultipart())
+
+	return &Server{
+		s:       New(opts...),
+		handler: handler,
+		timeout: timeout,
+	}
+}
+
+// GetSock gets the ROUTER Sock of server
+func (srv *Server) GetSock() *Sock {
+	return srv.s
+}
+
+// Serve receives requests and dispatches them onto Pool until ctx of socket is done
+func (srv *Server) Serve() {
+	Pool.CtxGo(srv.s.ctx, srv.dispatch)
+
+	srv.s.Router()
+}
+
+// dispatch reads requests from 'out' channel until socket released
+func (srv *Server) dispatch() {
+	for msg := range srv.s.out {
+		msg := msg
+		Pool.CtxGo(srv.s.ctx, func() {
+			srv.handle(msg)
+		})
+	}
+}
+
+// handle calls Handler with the request and sends back the reply with the same envelope
+func (srv *Server) handle(msg []byte) {
+	m, err := ParseMessage(msg)
+	if err != nil || len(m) < 2 {
+		log.Error().Err(err).Bytes("data", msg).Msg("server drop malformed request")
+		return
+	}
+
+	// identity and the empty delimiter of REQ client are kept in envelope
+	envelope, req := m[:len(m)-1], m[len(m)-1]
+
+	correlation := xid.NilID()
+	if srv.s.envelope {
+		e, err := srv.s.unwrap(msg)
+		if err != nil {
+			log.Error().Err(err).Bytes("data", msg).Msg("server drop malformed request")
+			return
+		}
+
+		req, correlation = e.Body, e.ID
+	}
+
+	body, err := srv.call(req)
+
+	reply := append(Message{}, envelope...)
+	reply = append(reply, NewReply(body, err))
+
+	if err := srv.s.SendReply(srv.s.ctx, reply.Bytes(), correlation); err != nil {
+		log.Error().Err(err).Msg("server failed to send reply")
+	}
+}
+
+// call runs Handler in a new thread, returns ErrTimeout when Handler does not return in timeout
+func (srv *Server) call(req []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(srv.s.ctx, srv.timeout)
+	defer cancel()
+
+	type result struct {
+		body []byte
+		err  error
+	}
+
+	ch := make(chan result, 1)
+
+	Pool.CtxGo(ctx, func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error().Msgf("handler panic: %v", r)
+				ch <- result{err: fmt.Errorf("handler panic: %v", r)}
+			}
+		}()
+
+		body, err := srv.handler(ctx, req)
+		ch <- result{body: body, err: err}
+	})
+
+	select {
+	case r := <-ch:
+		return r.body, r.err
+	case <-ctx.Done():
+		return nil, ctxErr(ctx)
+	}
+}
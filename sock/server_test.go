@@ -0,0 +1,52 @@
+package sock
+
+import (
+	"context"
+	"fmt"
+	A "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReply(t *testing.T) {
+	assert := A.New(t)
+
+	body, err := ParseReply(NewReply([]byte("world"), nil))
+	assert.Nil(err)
+	assert.Equal(body, []byte("world"))
+
+	_, err = ParseReply(NewReply(nil, fmt.Errorf("bad request")))
+	assert.Equal(err, &RemoteError{Msg: "bad request"})
+
+	_, err = ParseReply([]byte{})
+	assert.NotNil(err)
+
+	_, err = ParseReply([]byte{9})
+	assert.NotNil(err)
+}
+
+func TestServerCall(t *testing.T) {
+	assert := A.New(t)
+
+	srv := NewServer(func(ctx context.Context, req []byte) ([]byte, error) {
+		switch string(req) {
+		case "slow":
+			<-ctx.Done()
+			return nil, ctx.Err()
+		case "panic":
+			panic("boom")
+		}
+
+		return append(req, []byte(" world")...), nil
+	}, time.Millisecond*50, WithEndpoint("inproc://server"))
+
+	body, err := srv.call([]byte("hello"))
+	assert.Nil(err)
+	assert.Equal(body, []byte("hello world"))
+
+	_, err = srv.call([]byte("slow"))
+	assert.Equal(err, ErrTimeout)
+
+	_, err = srv.call([]byte("panic"))
+	assert.NotNil(err)
+}
@@ -6,6 +6,7 @@ import (
 	A "github.com/stretchr/testify/assert"
 	"github.com/zeromq/goczmq"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -306,6 +307,18 @@ func TestReqRep(t *testing.T) {
 	msg = <-qOut
 	assert.Equal(msg, responseMsg)
 
+	// no empty msg follows a reply
+	select {
+	case msg = <-qOut:
+		assert.Fail("unexpected msg after reply", "%q", msg)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	assert.Equal(req.GetSendMsgCount(), uint64(1))
+	assert.Equal(req.GetRecvMsgCount(), uint64(1))
+	assert.Equal(rep.GetSendMsgCount(), uint64(1))
+	assert.Equal(rep.GetRecvMsgCount(), uint64(1))
+
 	<-ctx.Done()
 }
 
@@ -384,3 +397,1414 @@ func TestResponserWithTypePanic(t *testing.T) {
 
 	soc.Responser()
 }
+
+func TestRouteMsg(t *testing.T) {
+	assert := A.New(t)
+
+	buf := NewRouteMsg([]byte("peer"), []byte("hello"))
+	identity, msg, err := SplitRouteMsg(buf)
+	assert.Nil(err)
+	assert.Equal(identity, []byte("peer"))
+	assert.Equal(msg, []byte("hello"))
+
+	_, _, err = SplitRouteMsg([]byte{})
+	assert.NotNil(err)
+
+	_, _, err = SplitRouteMsg([]byte{10, 'a'})
+	assert.NotNil(err)
+}
+
+func TestRouterDealer(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "inproc://router"
+
+	router := New(
+		WithCtx(ctx),
+		WithType("Router"),
+		WithEndpoint(endpoint),
+	)
+
+	go router.Router()
+
+	dealer1 := New(
+		WithCtx(ctx),
+		WithType("Dealer"),
+		WithEndpoint(endpoint),
+		WithIdentity("dealer1"),
+		WithAttach(),
+	)
+
+	go dealer1.Dealer()
+
+	dealer2 := New(
+		WithCtx(ctx),
+		WithType("Dealer"),
+		WithEndpoint(endpoint),
+		WithIdentity("dealer2"),
+		WithAttach(),
+	)
+
+	go dealer2.Dealer()
+
+	time.Sleep(time.Millisecond * 200) // wait dealer1 and dealer2 connection
+	dealer1.GetInChannel() <- []byte("ping1")
+	dealer2.GetInChannel() <- []byte("ping2")
+
+	for i := 0; i < 2; i++ {
+		identity, msg, err := SplitRouteMsg(<-router.GetOutChannel())
+		assert.Nil(err)
+		assert.Equal(string(msg), "ping"+string(identity[len(identity)-1]))
+
+		router.GetInChannel() <- NewRouteMsg(identity, append([]byte("pong"), identity[len(identity)-1]))
+	}
+
+	assert.Equal(<-dealer1.GetOutChannel(), []byte("pong1"))
+	assert.Equal(<-dealer2.GetOutChannel(), []byte("pong2"))
+
+	<-ctx.Done()
+}
+
+func TestRouterDelimiter(t *testing.T) {
+	assert := A.New(t)
+
+	router := New(WithType("Router"), WithEndpoint("inproc://router-delimiter"))
+	router.routes["req"] = [][]byte{{}}
+	router.routes["correlate"] = [][]byte{{0, 0, 0, 1}, {}}
+
+	frames, err := router.frames(NewRouteMsg([]byte("req"), []byte("pong")))
+	assert.Nil(err)
+	assert.Equal(frames, [][]byte{[]byte("req"), {}, []byte("pong")})
+
+	frames, err = router.frames(NewRouteMsg([]byte("correlate"), []byte("pong")))
+	assert.Nil(err)
+	assert.Equal(frames, [][]byte{[]byte("correlate"), {0, 0, 0, 1}, {}, []byte("pong")})
+
+	frames, err = router.frames(NewRouteMsg([]byte("dealer"), []byte("pong")))
+	assert.Nil(err)
+	assert.Equal(frames, [][]byte{[]byte("dealer"), []byte("pong")})
+}
+
+func TestRouterReq(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	endpoint := "inproc://router-req"
+
+	router := New(
+		WithCtx(ctx),
+		WithType("Router"),
+		WithEndpoint(endpoint),
+	)
+
+	go router.Router()
+
+	req := New(
+		WithCtx(ctx),
+		WithType("Req"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+	)
+
+	go req.Requester()
+
+	go func() {
+		identity, msg, err := SplitRouteMsg(<-router.GetOutChannel())
+		assert.Nil(err)
+		assert.Equal(msg, []byte("ping"))
+
+		router.GetInChannel() <- NewRouteMsg(identity, []byte("pong"))
+	}()
+
+	reply, err := req.Request(ctx, []byte("ping"))
+	assert.Nil(err)
+	assert.Equal(reply, []byte("pong"))
+}
+
+func TestRouterWithTypePanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			expectErr := "router only enables by 'type': Router"
+
+			if fmt.Sprintf("%s", r) != expectErr {
+				t.Errorf("no panic raised when calling Router with type 'pub', got %v", r)
+			}
+		}
+	}()
+	endpoint := "inproc://broadcast"
+	soc := New(
+		WithType("PUB"),
+		WithEndpoint(endpoint),
+	)
+
+	soc.Router()
+}
+
+func TestMultipartPushPull(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "inproc://multipart"
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithMultipart(),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithMultipart(),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait push connection
+	for i := 0; i < 100; i++ {
+		push.GetInChannel() <- NewMessage([]byte("header"), []byte("route"), []byte(strconv.Itoa(i))).Bytes()
+	}
+
+	<-ctx.Done()
+
+	out := pull.GetOutChannel()
+	assert.Equal(len(out), 100)
+	assert.Equal(pull.GetRecvMsgCount(), uint64(100))
+	assert.Equal(push.GetSendMsgCount(), uint64(100))
+
+	m, err := ParseMessage(<-out)
+	assert.Nil(err)
+	assert.Equal(len(m), 3)
+	assert.Equal(m[2], []byte("0"))
+}
+
+func TestCurvePubSub(t *testing.T) {
+	assert := A.New(t)
+
+	dir := t.TempDir()
+	serverCert := dir + "/server.key"
+	clientCert := dir + "/client.key"
+
+	_, err := GenerateCurveKeypair(serverCert)
+	assert.Nil(err)
+
+	client, err := GenerateCurveKeypair(clientCert)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "tcp://127.0.0.1:31555"
+
+	pub := New(
+		WithCtx(ctx),
+		WithType("Pub"),
+		WithEndpoint(endpoint),
+		WithCurveServer(serverCert),
+		WithCurveAllow(client.PublicKey),
+	)
+
+	go pub.Publisher()
+
+	sub := New(
+		WithCtx(ctx),
+		WithType("Sub"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithCurveClient(clientCert, serverCert),
+	)
+
+	go sub.Consumer()
+
+	time.Sleep(time.Millisecond * 500) // wait curve handshake
+	for i := 0; i < 100; i++ {
+		pub.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	<-ctx.Done()
+
+	assert.Equal(len(sub.GetOutChannel()), 100)
+}
+
+func TestCurveAllowScope(t *testing.T) {
+	assert := A.New(t)
+
+	dir := t.TempDir()
+	serverCert := dir + "/server.key"
+	clientCert := dir + "/client.key"
+	otherCert := dir + "/other.key"
+
+	_, err := GenerateCurveKeypair(serverCert)
+	assert.Nil(err)
+
+	_, err = GenerateCurveKeypair(clientCert)
+	assert.Nil(err)
+
+	other, err := GenerateCurveKeypair(otherCert)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	// allowlist of 'strict' does not contain client, 'open' has no allowlist
+	strict := New(WithCtx(ctx), WithType("Pull"), WithEndpoint("tcp://127.0.0.1:31561"),
+		WithCurveServer(serverCert), WithCurveAllow(other.PublicKey))
+	open := New(WithCtx(ctx), WithType("Pull"), WithEndpoint("tcp://127.0.0.1:31562"),
+		WithCurveServer(serverCert))
+
+	go strict.Consumer()
+	go open.Consumer()
+
+	for _, endpoint := range []string{"tcp://127.0.0.1:31561", "tcp://127.0.0.1:31562"} {
+		push := New(WithCtx(ctx), WithType("Push"), WithEndpoint(endpoint), WithAttach(),
+			WithCurveClient(clientCert, serverCert))
+		go push.Publisher()
+
+		push.GetInChannel() <- []byte("hello")
+	}
+
+	<-ctx.Done()
+
+	assert.Equal(strict.GetRecvMsgCount(), uint64(0))
+	assert.Equal(open.GetRecvMsgCount(), uint64(1))
+}
+
+func TestCurveAuthStop(t *testing.T) {
+	assert := A.New(t)
+
+	running := func() bool {
+		zap.mu.Lock()
+		defer zap.mu.Unlock()
+
+		return zap.handler != nil
+	}
+
+	key := "0123456789012345678901234567890123456789"
+	assert.Nil(zap.allow("nops-stop", []string{key}))
+	assert.True(running())
+
+	// handler stops when no domain is left
+	zap.remove("nops-stop")
+
+	deadline := time.Now().Add(time.Second)
+	for running() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	assert.False(running())
+
+	// and is started again by allow
+	assert.Nil(zap.allow("nops-stop", []string{key}))
+	assert.True(running())
+	zap.remove("nops-stop")
+}
+
+func TestTopicPubSub(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "inproc://topic"
+
+	pub := New(
+		WithCtx(ctx),
+		WithType("Pub"),
+		WithEndpoint(endpoint),
+		WithMultipart(),
+	)
+
+	go pub.Publisher()
+
+	sub := New(
+		WithCtx(ctx),
+		WithType("Sub"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithSubscribe("metric"),
+	)
+
+	go sub.Consumer()
+
+	time.Sleep(time.Millisecond * 200) // wait sub connection
+	pub.GetInChannel() <- NewTopicMsg("metric", []byte("cpu"))
+	pub.GetInChannel() <- NewTopicMsg("event", []byte("restart"))
+
+	assert.Equal(<-sub.GetOutChannel(), []byte("cpu"))
+
+	assert.Nil(sub.Unsubscribe("metric"))
+	assert.Nil(sub.Subscribe("event"))
+	assert.Equal(sub.GetTopics(), []string{"event"})
+
+	time.Sleep(time.Millisecond * 200) // wait subscription take effect
+	pub.GetInChannel() <- NewTopicMsg("metric", []byte("mem"))
+	pub.GetInChannel() <- NewTopicMsg("event", []byte("reload"))
+
+	assert.Equal(<-sub.GetOutChannel(), []byte("reload"))
+
+	<-ctx.Done()
+
+	assert.Equal(len(sub.GetOutChannel()), 0)
+}
+
+func TestSpoolReplayOnPublisher(t *testing.T) {
+	assert := A.New(t)
+
+	dir := t.TempDir()
+	endpoint := "inproc://spool"
+
+	// no peer is connected, msg are left in buffer and spooled after exit wait timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithSendTimeoutSec(1),
+		WithRetryAttempts(1),
+		WithExitWaitTimeout(time.Millisecond*100),
+		WithSpool(dir),
+	)
+
+	for i := 0; i < 10; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	push.Publisher()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+	)
+
+	go pull.Consumer()
+
+	push = New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithSpool(dir),
+	)
+
+	go push.Publisher()
+
+	<-ctx.Done()
+
+	assert.Equal(len(pull.GetOutChannel()), 10)
+	assert.Equal(<-pull.GetOutChannel(), []byte("0"))
+}
+
+func TestMonitor(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	endpoint := "tcp://127.0.0.1:31556"
+	events := make(chan MonitorEvent, 100)
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithMonitorChannel(events),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		EnableMonitor(),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 500) // wait push connection
+
+	assert.True(pull.State().Listening)
+	assert.True(pull.State().Connected())
+	assert.True(push.State().Connected())
+
+	types := make(map[MonitorEventType]bool)
+	for len(events) > 0 {
+		types[(<-events).Type] = true
+	}
+
+	assert.True(types[EventListening])
+	assert.True(types[EventAccepted])
+
+	<-ctx.Done()
+}
+
+func TestSendRecvRequest(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint("inproc://api-pull"),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint("inproc://api-pull"),
+		WithAttach(),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait push connection
+	assert.Nil(push.Send(ctx, []byte("hello")))
+
+	msg, err := pull.Recv(ctx)
+	assert.Nil(err)
+	assert.Equal(msg, []byte("hello"))
+
+	rep := New(
+		WithCtx(ctx),
+		WithType("Rep"),
+		WithEndpoint("inproc://api-rep"),
+	)
+
+	go rep.Responser()
+
+	req := New(
+		WithCtx(ctx),
+		WithType("Req"),
+		WithEndpoint("inproc://api-rep"),
+		WithAttach(),
+		WithRecvTimeoutSec(1),
+	)
+
+	go req.Requester()
+
+	go func() {
+		request := <-rep.GetOutChannel()
+		rep.GetInChannel() <- append(request, []byte(" world")...)
+	}()
+
+	reply, err := req.Request(ctx, []byte("hello"))
+	assert.Nil(err)
+	assert.Equal(reply, []byte("hello world"))
+
+	<-ctx.Done()
+}
+
+func TestRequestAfterTimeout(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	rep := New(
+		WithCtx(ctx),
+		WithType("Rep"),
+		WithEndpoint("inproc://api-rep-relaxed"),
+	)
+
+	go rep.Responser()
+
+	req := New(
+		WithCtx(ctx),
+		WithType("Req"),
+		WithEndpoint("inproc://api-rep-relaxed"),
+		WithAttach(),
+		WithRecvTimeoutSec(1),
+	)
+
+	go req.Requester()
+
+	go func() {
+		// the reply of the first request is late and dropped by REQ
+		request := <-rep.GetOutChannel()
+		time.Sleep(time.Millisecond * 300)
+		rep.GetInChannel() <- append(request, []byte(" late")...)
+
+		request = <-rep.GetOutChannel()
+		rep.GetInChannel() <- append(request, []byte(" world")...)
+	}()
+
+	short, shortCancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer shortCancel()
+
+	start := time.Now()
+	_, err := req.Request(short, []byte("first"))
+	assert.Equal(err, ErrTimeout)
+	assert.True(time.Since(start) < time.Millisecond*500)
+
+	reply, err := req.Request(ctx, []byte("second"))
+	assert.Nil(err)
+	assert.Equal(reply, []byte("second world"))
+
+	<-ctx.Done()
+}
+
+func TestLazyPirate(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5000)
+	defer cancel()
+
+	// the first endpoint has no server, requests fail over to the second one
+	rep := New(
+		WithCtx(ctx),
+		WithType("Rep"),
+		WithEndpoint("tcp://127.0.0.1:31558"),
+	)
+
+	go rep.Responser()
+
+	go func() {
+		for {
+			select {
+			case request := <-rep.GetOutChannel():
+				rep.GetInChannel() <- append(request, []byte(" world")...)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	client := NewLazyPirate(
+		[]string{"tcp://127.0.0.1:31557", "tcp://127.0.0.1:31558"},
+		WithRecvTimeoutSec(1),
+		WithRetryAttempts(3),
+	)
+	defer client.Close()
+
+	reply, err := client.Request(ctx, []byte("hello"))
+	assert.Nil(err)
+	assert.Equal(reply, []byte("hello world"))
+	assert.Equal(client.GetEndpoint(), "tcp://127.0.0.1:31558")
+
+	client.Close()
+	_, err = client.Request(ctx, []byte("hello"))
+	assert.Equal(err, ErrClosed)
+}
+
+func TestServer(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "inproc://server"
+
+	srv := NewServer(func(ctx context.Context, req []byte) ([]byte, error) {
+		if string(req) == "slow" {
+			time.Sleep(time.Millisecond * 500)
+		}
+
+		return append(req, []byte(" world")...), nil
+	}, time.Millisecond*200, WithCtx(ctx), WithEndpoint(endpoint))
+
+	go srv.Serve()
+
+	slow := New(
+		WithCtx(ctx),
+		WithType("Req"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+	)
+
+	go slow.Requester()
+
+	fast := New(
+		WithCtx(ctx),
+		WithType("Req"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+	)
+
+	go fast.Requester()
+
+	time.Sleep(time.Millisecond * 200) // wait req connection
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		reply, err := slow.Request(ctx, []byte("slow"))
+		assert.Nil(err)
+
+		_, err = ParseReply(reply)
+		assert.Equal(err, &RemoteError{Msg: ErrTimeout.Error()})
+	}()
+
+	// slow request does not stall others
+	start := time.Now()
+	reply, err := fast.Request(ctx, []byte("hello"))
+	assert.Nil(err)
+	assert.True(time.Since(start) < time.Millisecond*200)
+
+	body, err := ParseReply(reply)
+	assert.Nil(err)
+	assert.Equal(body, []byte("hello world"))
+
+	<-done
+	<-ctx.Done()
+}
+
+func TestServerEnvelope(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	endpoint := "inproc://server-envelope"
+
+	srv := NewServer(func(ctx context.Context, req []byte) ([]byte, error) {
+		return append(req, []byte(" world")...), nil
+	}, time.Millisecond*200, WithCtx(ctx), WithEndpoint(endpoint), WithEnvelope())
+
+	go srv.Serve()
+
+	client := New(
+		WithCtx(ctx),
+		WithType("Req"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithEnvelope(),
+	)
+
+	go client.Requester()
+
+	time.Sleep(time.Millisecond * 200) // wait req connection
+
+	reply, err := client.Request(ctx, []byte("hello"))
+	assert.Nil(err)
+
+	// handler gets the body of request, and reply is correlated with it
+	e, err := client.Unwrap(reply)
+	assert.Nil(err)
+	assert.False(e.CorrelationID.IsNil())
+
+	body, err := ParseReply(e.Body)
+	assert.Nil(err)
+	assert.Equal(body, []byte("hello world"))
+
+	<-ctx.Done()
+}
+
+func TestTypedSock(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "inproc://typed-push"
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+	)
+
+	go push.Publisher()
+
+	consumer := NewTypedSock[metric](pull, JSONCodec{})
+	producer := NewTypedSock[metric](push, JSONCodec{})
+
+	time.Sleep(time.Millisecond * 200) // wait push connection
+	producer.In() <- metric{Name: "cpu", Value: 0.5}
+	assert.Nil(producer.Send(ctx, metric{Name: "mem", Value: 0.7}))
+
+	assert.Equal(<-consumer.Out(), metric{Name: "cpu", Value: 0.5})
+	assert.Equal(<-consumer.Out(), metric{Name: "mem", Value: 0.7})
+
+	<-ctx.Done()
+}
+
+func TestEnvelopePushPull(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "inproc://envelope-push-pull"
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithEnvelope(),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithEnvelope(),
+		WithProducerID("producer"),
+		WithSchemaVersion(1),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait push connection
+	for i := 0; i < 100; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	time.Sleep(time.Millisecond * 500)
+
+	e, err := pull.RecvEnvelope(ctx)
+	assert.Nil(err)
+	assert.Equal(e.ProducerID, "producer")
+	assert.Equal(e.SchemaVersion, uint16(1))
+	assert.Equal(e.Body, []byte("0"))
+	assert.False(e.ID.IsNil())
+
+	<-ctx.Done()
+
+	assert.Equal(pull.GetRecvMsgCount(), uint64(100))
+	assert.Equal(push.GetSendMsgCount(), uint64(100))
+}
+
+func TestProxyPullPush(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	proxy := NewProxy(
+		New(WithCtx(ctx), WithType("Pull"), WithEndpoint("inproc://proxy-front")),
+		New(WithCtx(ctx), WithType("Push"), WithEndpoint("inproc://proxy-back")),
+		New(WithCtx(ctx), WithType("Push"), WithEndpoint("inproc://proxy-capture")),
+	)
+
+	go proxy.Run()
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint("inproc://proxy-back"),
+		WithAttach(),
+		WithMaxBufferSize(1000),
+	)
+
+	go pull.Consumer()
+
+	capture := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint("inproc://proxy-capture"),
+		WithAttach(),
+		WithMaxBufferSize(1000),
+	)
+
+	go capture.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint("inproc://proxy-front"),
+		WithAttach(),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait connection
+	for i := 0; i < 100; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	time.Sleep(time.Millisecond * 500)
+
+	proxy.Pause()
+	for i := 0; i < 100; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	time.Sleep(time.Millisecond * 500)
+	assert.Equal(pull.GetRecvMsgCount(), uint64(100))
+
+	proxy.Resume()
+	time.Sleep(time.Millisecond * 500)
+
+	assert.Equal(pull.GetRecvMsgCount(), uint64(200))
+	assert.Equal(capture.GetRecvMsgCount(), uint64(200))
+	assert.Equal(proxy.GetFrontend().GetRecvMsgCount(), uint64(200))
+	assert.Equal(proxy.GetBackend().GetSendMsgCount(), uint64(200))
+
+	assert.Nil(proxy.Terminate())
+}
+
+func TestProxyControl(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	// capture has no peer
+	proxy := NewProxy(
+		New(WithCtx(ctx), WithType("Pull"), WithEndpoint("inproc://proxy-control-front")),
+		New(WithCtx(ctx), WithType("Push"), WithEndpoint("inproc://proxy-control-back")),
+		New(WithCtx(ctx), WithType("Push"), WithEndpoint("inproc://proxy-control-capture")),
+	)
+
+	go proxy.Run()
+
+	// control funcs of proxy sockets are served
+	assert.Nil(proxy.GetFrontend().Ready(ctx))
+	assert.Nil(proxy.GetBackend().AddEndpoint("inproc://proxy-control-back2", false))
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint("inproc://proxy-control-back2"),
+		WithAttach(),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint("inproc://proxy-control-front"),
+		WithAttach(),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait connection
+	for i := 0; i < 10; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	time.Sleep(time.Millisecond * 300)
+
+	// capture without peer does not block forwarding
+	assert.Equal(pull.GetRecvMsgCount(), uint64(10))
+	assert.Equal(proxy.GetCapture().GetDropMsgCount(), uint64(10))
+
+	assert.Nil(proxy.Terminate())
+}
+
+func TestManagerPushPull(t *testing.T) {
+	assert := A.New(t)
+
+	m := NewManager(context.Background(), time.Second*5)
+
+	pull, _ := m.Create("pull", WithType("Pull"), WithEndpoint("inproc://manager"), WithMaxBufferSize(1000))
+	push, _ := m.Create("push", WithType("Push"), WithEndpoint("inproc://manager"), WithAttach())
+
+	assert.Nil(m.Start())
+
+	time.Sleep(time.Millisecond * 200) // wait push connection
+	for i := 0; i < 100; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	time.Sleep(time.Millisecond * 500)
+
+	for _, s := range m.Status() {
+		assert.Equal(s.State, StateRunning)
+	}
+
+	assert.Equal(pull.GetRecvMsgCount(), uint64(100))
+	assert.Nil(m.Stop())
+
+	for _, s := range m.Status() {
+		assert.Equal(s.State, StateStopped)
+	}
+}
+
+func TestMultipleEndpoints(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	pub1 := New(WithCtx(ctx), WithType("Pub"), WithEndpoint("tcp://127.0.0.1:31559"))
+	go pub1.Publisher()
+
+	pub2 := New(WithCtx(ctx), WithType("Pub"), WithEndpoint("tcp://127.0.0.1:31560"))
+	go pub2.Publisher()
+
+	sub := New(
+		WithCtx(ctx),
+		WithType("Sub"),
+		WithBind("inproc://multiple-endpoints"),
+		WithConnect("tcp://127.0.0.1:31559"),
+		WithMaxBufferSize(1000),
+	)
+
+	go sub.Consumer()
+
+	pub3 := New(WithCtx(ctx), WithType("Pub"), WithEndpoint("inproc://multiple-endpoints"), WithAttach())
+	go pub3.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait sub connection
+	assert.Nil(sub.AddEndpoint("tcp://127.0.0.1:31560", true))
+	time.Sleep(time.Millisecond * 200) // wait runtime connection
+
+	for i := 0; i < 100; i++ {
+		pub1.GetInChannel() <- []byte(strconv.Itoa(i))
+		pub2.GetInChannel() <- []byte(strconv.Itoa(i))
+		pub3.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	time.Sleep(time.Millisecond * 500)
+	assert.Equal(sub.GetRecvMsgCount(), uint64(300))
+
+	assert.Nil(sub.RemoveEndpoint("tcp://127.0.0.1:31560"))
+	time.Sleep(time.Millisecond * 200) // wait runtime disconnection
+
+	// error of bind is returned, endpoint failed is not added
+	assert.NotNil(sub.AddEndpoint("tcp://no-such-host:31562", false))
+	assert.Equal(len(sub.GetEndpoints()), 2)
+
+	for i := 0; i < 100; i++ {
+		pub2.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	<-ctx.Done()
+	assert.Equal(sub.GetRecvMsgCount(), uint64(300))
+}
+
+func TestBatchPushPull(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	endpoint := "inproc://batch-push-pull"
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithMaxBufferSize(1000),
+		WithEnvelope(),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithBatch(100, 0, time.Millisecond*100),
+		WithCompression(CompressZstd),
+		WithEnvelope(),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait push connection
+	for i := 0; i < 250; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	<-ctx.Done()
+
+	out := pull.GetOutChannel()
+	assert.Equal(len(out), 250)
+	assert.Equal(pull.GetRecvMsgCount(), uint64(250))
+	assert.Equal(push.GetSendMsgCount(), uint64(3))
+
+	e, err := ParseEnvelope(<-out)
+	assert.Nil(err)
+	assert.Equal(e.Body, []byte("0"))
+}
+
+func TestLanePushPull(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	endpoint := "inproc://lane-push-pull"
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithMaxBufferSize(1000),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithMaxBufferSize(1000),
+		WithLanes(LaneStrict, Lane{Name: "control", Size: 10}),
+	)
+
+	// msg queued before Publisher starts, control msg goes first
+	for i := 0; i < 500; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+	assert.Nil(push.PutLane("control", []byte("shutdown")))
+
+	time.Sleep(time.Millisecond * 200) // wait pull bind
+	go push.Publisher()
+
+	<-ctx.Done()
+
+	out := pull.GetOutChannel()
+	assert.Equal(len(out), 501)
+	assert.Equal(<-out, []byte("shutdown"))
+	assert.Equal(push.GetLaneStats()[0].Sent, uint64(1))
+	assert.Equal(push.GetLaneStats()[1].Sent, uint64(500))
+}
+
+func TestLaneWeightedPushPull(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	endpoint := "inproc://lane-weighted-push-pull"
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithMaxBufferSize(1000),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithMaxBufferSize(1000),
+		WithLanes(LaneWeighted, Lane{Name: "high", Weight: 3}),
+	)
+
+	for i := 0; i < 300; i++ {
+		assert.Nil(push.PutLane("high", []byte("high")))
+		push.GetInChannel() <- []byte("low")
+	}
+
+	time.Sleep(time.Millisecond * 200) // wait pull bind
+	go push.Publisher()
+
+	// 'in' channel is served by the weight of DefaultLane through the real loop
+	counts := map[string]int{}
+	for i := 0; i < 200; i++ {
+		msg, err := pull.Recv(ctx)
+		assert.Nil(err)
+		counts[string(msg)]++
+	}
+
+	assert.Equal(counts["high"], 150)
+	assert.Equal(counts["low"], 50)
+
+	<-ctx.Done()
+}
+
+func TestSequencePushPull(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	endpoint := "inproc://sequence-push-pull"
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithMaxBufferSize(1000),
+		WithDedupe(100, nil),
+		WithReorder(time.Millisecond*100),
+	)
+
+	go pull.Consumer()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithSequence(),
+	)
+
+	go push.Publisher()
+
+	time.Sleep(time.Millisecond * 200) // wait push connection
+	for i := 0; i < 100; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	<-ctx.Done()
+
+	out := pull.GetOutChannel()
+	assert.Equal(len(out), 100)
+	assert.Equal(pull.GetDupMsgCount(), uint64(0))
+	assert.Equal(pull.GetGapMsgCount(), uint64(0))
+
+	e, err := ParseEnvelope(<-out)
+	assert.Nil(err)
+
+	seq, ok := e.Sequence()
+	assert.True(ok)
+	assert.Equal(seq, uint64(1))
+}
+
+func TestAckPushPull(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2000)
+	defer cancel()
+
+	endpoint := "inproc://ack-push-pull"
+	ackEndpoint := "inproc://ack-push-pull-link"
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint(endpoint),
+		WithAck(ackEndpoint, time.Millisecond*300, 5),
+	)
+
+	go push.Publisher()
+
+	pull := New(
+		WithCtx(ctx),
+		WithType("Pull"),
+		WithEndpoint(endpoint),
+		WithAttach(),
+		WithMaxBufferSize(100),
+		WithAckConnect(ackEndpoint),
+	)
+
+	go pull.Consumer()
+
+	time.Sleep(time.Millisecond * 200) // wait pull and ack link connection
+	for i := 0; i < 10; i++ {
+		push.GetInChannel() <- []byte(strconv.Itoa(i))
+	}
+
+	// the first delivery of msg "0" is not acked
+	var received int
+	skipped := false
+	for {
+		select {
+		case msg := <-pull.GetOutChannel():
+			received++
+
+			e, err := ParseEnvelope(msg)
+			assert.Nil(err)
+
+			if string(e.Body) == "0" && !skipped {
+				skipped = true
+				continue
+			}
+
+			assert.Nil(pull.Ack(msg))
+		case <-time.After(time.Millisecond * 1000):
+			assert.Equal(received, 11)
+			assert.Equal(push.GetUnackedCount(), 0)
+			assert.Equal(push.GetAckedCount(), uint64(10))
+			assert.Equal(push.GetRedeliveredCount(), uint64(1))
+			return
+		}
+	}
+}
+
+// panicFault panics the next sends of socket
+type panicFault struct {
+	panics atomic.Int32
+}
+
+func (f *panicFault) Send(_ [][]byte) error {
+	if f.panics.Add(-1) >= 0 {
+		panic(fmt.Errorf("injected send panic"))
+	}
+
+	return nil
+}
+
+func (f *panicFault) Recv(_ [][]byte) error {
+	return nil
+}
+
+func TestManagerRestart(t *testing.T) {
+	assert := A.New(t)
+
+	m := NewManager(context.Background(), time.Second)
+
+	fault := &panicFault{}
+	fault.panics.Store(1)
+
+	pull, err := m.Create("pull", WithType("PULL"), WithEndpoint("inproc://manager-restart"))
+	assert.Nil(err)
+
+	push, err := m.Create("push", WithType("PUSH"), WithEndpoint("inproc://manager-restart"), WithAttach(),
+		WithFault(fault))
+	assert.Nil(err)
+
+	assert.Nil(m.Start())
+
+	// the msg crashing Publisher is lost, the loop is restarted on a new socket
+	push.GetInChannel() <- []byte("crash")
+
+	deadline := time.Now().Add(time.Second)
+	for m.Status()[1].Restarts == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	assert.Equal(m.Status()[1].Restarts, 1)
+
+	push.GetInChannel() <- []byte("hello")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := pull.Recv(ctx)
+	assert.Nil(err)
+	assert.Equal(msg, []byte("hello"))
+
+	assert.Nil(m.Stop())
+}
+
+func TestResponserEndpoint(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	rep := New(
+		WithCtx(ctx),
+		WithType("Rep"),
+		WithEndpoint("inproc://rep-endpoint-a"),
+	)
+
+	go rep.Responser()
+
+	time.Sleep(time.Millisecond * 100) // wait rep bound
+
+	// Responser applies endpoint change between receives
+	assert.Nil(rep.AddEndpoint("inproc://rep-endpoint-b", false))
+
+	req := New(
+		WithCtx(ctx),
+		WithType("Req"),
+		WithEndpoint("inproc://rep-endpoint-b"),
+		WithAttach(),
+	)
+
+	go req.Requester()
+
+	go func() {
+		request := <-rep.GetOutChannel()
+		rep.GetInChannel() <- append(request, []byte(" world")...)
+	}()
+
+	reply, err := req.Request(ctx, []byte("hello"))
+	assert.Nil(err)
+	assert.Equal(reply, []byte("hello world"))
+
+	<-ctx.Done()
+}
+
+func TestDiscoveryConnect(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*2500)
+	defer cancel()
+
+	d, err := NewDiscovery(ctx, "127.0.0.1:31604", time.Millisecond*50, time.Millisecond*300)
+	assert.Nil(err)
+	defer d.Close()
+
+	pub := New(WithCtx(ctx), WithType("Pub"), WithEndpoint("tcp://127.0.0.1:31603"))
+	go pub.Publisher()
+
+	sub := New(WithCtx(ctx), WithType("Sub"), WithDiscovery(d, "market"))
+	go sub.Consumer()
+
+	assert.Nil(d.Announce("market", "tcp://127.0.0.1:31603"))
+
+	// the endpoint discovered is connected by the running Consumer
+	var msg []byte
+	for msg == nil && ctx.Err() == nil {
+		pub.GetInChannel() <- []byte("tick")
+
+		recvCtx, recvCancel := context.WithTimeout(ctx, time.Millisecond*100)
+		msg, _ = sub.Recv(recvCtx)
+		recvCancel()
+	}
+
+	assert.Equal(msg, []byte("tick"))
+	assert.Equal(sub.GetEndpoints(), []EndpointSpec{{Addr: "tcp://127.0.0.1:31603", Connect: true}})
+
+	<-ctx.Done()
+}
+
+func TestRateLimitReady(t *testing.T) {
+	assert := A.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	push := New(
+		WithCtx(ctx),
+		WithType("Push"),
+		WithEndpoint("inproc://ratelimit-ready"),
+		WithMsgRateLimit(0.5, 1),
+	)
+
+	go push.Publisher()
+
+	push.GetInChannel() <- []byte("a")
+	push.GetInChannel() <- []byte("b")
+
+	// the second msg waits 2s for rate limit, control funcs are still served
+	time.Sleep(time.Millisecond * 100)
+
+	start := time.Now()
+	assert.Nil(push.Ready(ctx))
+	assert.Less(time.Since(start), time.Millisecond*500)
+
+	<-ctx.Done()
+}
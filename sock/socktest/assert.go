@@ -0,0 +1,93 @@
+package socktest
+
+import (
+	"fmt"
+	"github.com/lafrinte/nops/sock"
+	"testing"
+	"time"
+)
+
+// DefaultPollInterval is the interval of checking condition in Eventually
+const DefaultPollInterval = time.Millisecond * 5
+
+// Eventually checks cond every DefaultPollInterval and fails t with msg when cond is still false after timeout,
+// msg is called only on failure so it reports the latest state
+func Eventually(t testing.TB, cond func() bool, timeout time.Duration, msg func() string) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Errorf("socktest: %s in %s", msg(), timeout)
+			return false
+		}
+
+		time.Sleep(DefaultPollInterval)
+	}
+
+	return true
+}
+
+// WaitSent waits until send counter of s reaches n
+func WaitSent(t testing.TB, s *sock.Sock, n uint64, timeout time.Duration) bool {
+	t.Helper()
+
+	return Eventually(t, func() bool { return s.GetSendMsgCount() >= n }, timeout, func() string {
+		return fmt.Sprintf("sock %s sent %d msg, want %d", s.GetID(), s.GetSendMsgCount(), n)
+	})
+}
+
+// WaitRecv waits until receive counter of s reaches n
+func WaitRecv(t testing.TB, s *sock.Sock, n uint64, timeout time.Duration) bool {
+	t.Helper()
+
+	return Eventually(t, func() bool { return s.GetRecvMsgCount() >= n }, timeout, func() string {
+		return fmt.Sprintf("sock %s received %d msg, want %d", s.GetID(), s.GetRecvMsgCount(), n)
+	})
+}
+
+// WaitDrop waits until drop counter of s reaches n
+func WaitDrop(t testing.TB, s *sock.Sock, n uint64, timeout time.Duration) bool {
+	t.Helper()
+
+	return Eventually(t, func() bool { return s.GetDropMsgCount() >= n }, timeout, func() string {
+		return fmt.Sprintf("sock %s dropped %d msg, want %d", s.GetID(), s.GetDropMsgCount(), n)
+	})
+}
+
+// WaitDrained waits until 'in' channel, retry buffer and batch of s are empty, that is all msg are sent or dropped
+func WaitDrained(t testing.TB, s *sock.Sock, timeout time.Duration) bool {
+	t.Helper()
+
+	drained := func() bool {
+		return s.GetInCount() == 0 && s.GetRetryCount() == 0 && s.GetBatchCount() == 0
+	}
+
+	return Eventually(t, drained, timeout, func() string {
+		return fmt.Sprintf("sock %s not drained: in [%d] retry [%d] batch [%d]", s.GetID(),
+			s.GetInCount(), s.GetRetryCount(), s.GetBatchCount())
+	})
+}
+
+// WaitState waits until the monitor state of s satisfies cond, s must be created with sock.EnableMonitor. inproc
+// endpoints emit no monitor event, so it only works on tcp and ipc endpoints
+func WaitState(t testing.TB, s *sock.Sock, cond func(state sock.SockState) bool, timeout time.Duration) bool {
+	t.Helper()
+
+	return Eventually(t, func() bool { return cond(s.State()) }, timeout, func() string {
+		return fmt.Sprintf("sock %s state not reached: %+v", s.GetID(), s.State())
+	})
+}
+
+// AssertCounters checks send, receive and drop counters of s at once
+func AssertCounters(t testing.TB, s *sock.Sock, sent, received, dropped uint64) bool {
+	t.Helper()
+
+	if s.GetSendMsgCount() != sent || s.GetRecvMsgCount() != received || s.GetDropMsgCount() != dropped {
+		t.Errorf("socktest: sock %s counters: sent %d received %d dropped %d, want %d %d %d", s.GetID(),
+			s.GetSendMsgCount(), s.GetRecvMsgCount(), s.GetDropMsgCount(), sent, received, dropped)
+		return false
+	}
+
+	return true
+}
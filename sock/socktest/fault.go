@@ -0,0 +1,168 @@
+package socktest
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInjectedSend is returned by the send failed by Faults
+	ErrInjectedSend = errors.New("socktest: injected send error")
+	// ErrInjectedRecv is returned by the receive failed by Faults
+	ErrInjectedRecv = errors.New("socktest: injected recv error")
+)
+
+/*
+Faults is a sock.Fault which fails, delays or panics the io of socket on demand.
+
+	faults := socktest.NewFaults()
+	s := sock.New(sock.WithFault(faults), ...)
+	faults.FailSend(3) // the next 3 sends fail, msg goes into the retry path
+*/
+type Faults struct {
+	mu sync.Mutex
+
+	sendErrs    int
+	recvErrs    int
+	sendPanics  int
+	recvPanics  int
+	sendLatency time.Duration
+	recvLatency time.Duration
+
+	sent     int
+	received int
+}
+
+// NewFaults creates Faults injecting nothing
+func NewFaults() *Faults {
+	return &Faults{}
+}
+
+// FailSend makes the next n sends fail with ErrInjectedSend
+func (f *Faults) FailSend(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sendErrs = n
+}
+
+// FailRecv makes the next n msg received dropped with ErrInjectedRecv
+func (f *Faults) FailRecv(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.recvErrs = n
+}
+
+// PanicSend makes the next n sends panic, the msg being sent is lost. the run loop of sock created with
+// sock.WithAutoRestart is restarted on a new socket after ReconnectIvlMillSec, it exits otherwise
+func (f *Faults) PanicSend(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sendPanics = n
+}
+
+// PanicRecv makes the next n receives panic, the msg received is lost. the run loop of sock is restarted on a new
+// socket as PanicSend, a bound inproc endpoint loses the peers connected to the crashed socket
+func (f *Faults) PanicRecv(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.recvPanics = n
+}
+
+// SetLatency delays every send and receive, zero disables latency
+func (f *Faults) SetLatency(send, recv time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sendLatency = send
+	f.recvLatency = recv
+}
+
+// Reset stops injecting all faults
+func (f *Faults) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sendErrs, f.recvErrs, f.sendPanics, f.recvPanics = 0, 0, 0, 0
+	f.sendLatency, f.recvLatency = 0, 0
+}
+
+// Sent gets the count of sends passed through Faults, failed ones included
+func (f *Faults) Sent() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.sent
+}
+
+// Received gets the count of msg received through Faults, dropped ones included
+func (f *Faults) Received() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.received
+}
+
+func (f *Faults) Send(_ [][]byte) error {
+	f.mu.Lock()
+	f.sent++
+	latency := f.sendLatency
+
+	var panics, fails bool
+	if f.sendPanics > 0 {
+		f.sendPanics--
+		panics = true
+	} else if f.sendErrs > 0 {
+		f.sendErrs--
+		fails = true
+	}
+	f.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	if panics {
+		panic(ErrInjectedSend)
+	}
+
+	if fails {
+		return ErrInjectedSend
+	}
+
+	return nil
+}
+
+func (f *Faults) Recv(_ [][]byte) error {
+	f.mu.Lock()
+	f.received++
+	latency := f.recvLatency
+
+	var panics, fails bool
+	if f.recvPanics > 0 {
+		f.recvPanics--
+		panics = true
+	} else if f.recvErrs > 0 {
+		f.recvErrs--
+		fails = true
+	}
+	f.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	if panics {
+		panic(ErrInjectedRecv)
+	}
+
+	if fails {
+		return ErrInjectedRecv
+	}
+
+	return nil
+}
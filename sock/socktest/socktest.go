@@ -0,0 +1,142 @@
+/*
+Package socktest provides connected sock.Sock pairs over inproc endpoints, fault injection and assertion
+helpers, so the retry, spool and recovery paths of sock can be tested without tcp ports.
+
+	p := socktest.NewPair(t, "PUSH/PULL", sock.WithRetryInterval(time.Millisecond))
+	p.SenderFaults.FailSend(2)
+	p.Sender.GetInChannel() <- []byte("hello")
+	socktest.WaitRecv(t, p.Receiver, 1, time.Second)
+*/
+package socktest
+
+import (
+	"context"
+	"fmt"
+	"github.com/lafrinte/nops/sock"
+	"github.com/lafrinte/nops/str"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	DefaultCloseTimeout = time.Second * 5
+	DefaultReadyTimeout = time.Second
+)
+
+// Pair is a connected pair of sockets running their loop, Receiver binds the endpoint and Sender connects it
+type Pair struct {
+	Endpoint string
+
+	Sender         *sock.Sock
+	Receiver       *sock.Sock
+	SenderFaults   *Faults
+	ReceiverFaults *Faults
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Endpoint creates a uniq inproc endpoint
+func Endpoint() string {
+	return "inproc://socktest-" + str.ID().String()
+}
+
+/*
+NewPair creates a Pair by pattern "SENDER/RECEIVER", opts are applied to both sockets. both loops are started
+and the pair is closed by t.Cleanup.
+
+	supported pattern: PUSH/PULL, PUB/SUB, REQ/REP, DEALER/ROUTER
+*/
+func NewPair(t testing.TB, pattern string, opts ...sock.Option) *Pair {
+	t.Helper()
+
+	types := strings.Split(strings.ToUpper(pattern), "/")
+	if len(types) != 2 {
+		t.Fatalf("socktest: malformed pattern %s", pattern)
+	}
+
+	switch strings.Join(types, "/") {
+	case "PUSH/PULL", "PUB/SUB", "REQ/REP", "DEALER/ROUTER":
+	default:
+		t.Fatalf("socktest: unsupported pattern %s", pattern)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &Pair{
+		Endpoint:       Endpoint(),
+		SenderFaults:   NewFaults(),
+		ReceiverFaults: NewFaults(),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+
+	p.Receiver = sock.New(append(append([]sock.Option{}, opts...),
+		sock.WithCtx(ctx),
+		sock.WithType(types[1]),
+		sock.WithBind(p.Endpoint),
+		sock.WithFault(p.ReceiverFaults),
+	)...)
+
+	p.Sender = sock.New(append(append([]sock.Option{}, opts...),
+		sock.WithCtx(ctx),
+		sock.WithType(types[0]),
+		sock.WithConnect(p.Endpoint),
+		sock.WithFault(p.SenderFaults),
+	)...)
+
+	t.Cleanup(func() {
+		if err := p.Close(); err != nil {
+			t.Errorf("socktest: %s", err)
+		}
+	})
+
+	// inproc endpoint emits no monitor event, it is connected at once when it has been bound
+	go p.Receiver.Run()
+	p.ready(t, p.Receiver)
+
+	go p.Sender.Run()
+	p.ready(t, p.Sender)
+
+	return p
+}
+
+// ready waits until the loop of s has attached its endpoints
+func (p *Pair) ready(t testing.TB, s *sock.Sock) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(p.ctx, DefaultReadyTimeout)
+	defer cancel()
+
+	if err := s.Ready(ctx); err != nil {
+		t.Fatalf("socktest: sock %s is not ready: %s", s.GetID(), err)
+	}
+}
+
+// Disconnect disconnects Sender from Receiver at runtime and returns after it is done, msg sent is kept in queue
+// or dropped by socket type
+func (p *Pair) Disconnect() error {
+	return p.Sender.RemoveEndpoint(p.Endpoint)
+}
+
+// Reconnect connects Sender to Receiver again after Disconnect and returns after it is done
+func (p *Pair) Reconnect() error {
+	return p.Sender.AddEndpoint(p.Endpoint, true)
+}
+
+// Close stops both loops and waits until both sockets are released
+func (p *Pair) Close() error {
+	p.cancel()
+
+	deadline := time.After(DefaultCloseTimeout)
+	for _, s := range []*sock.Sock{p.Sender, p.Receiver} {
+		select {
+		case <-s.Done():
+		case <-deadline:
+			return fmt.Errorf("sock %s is not released in %s", s.GetID(), DefaultCloseTimeout)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package socktest
+
+import (
+	"github.com/lafrinte/nops/sock"
+	A "github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFaults(t *testing.T) {
+	assert := A.New(t)
+
+	f := NewFaults()
+	assert.Nil(f.Send(nil))
+	assert.Nil(f.Recv(nil))
+
+	f.FailSend(2)
+	assert.Equal(f.Send(nil), ErrInjectedSend)
+	assert.Equal(f.Send(nil), ErrInjectedSend)
+	assert.Nil(f.Send(nil))
+
+	f.FailRecv(1)
+	assert.Equal(f.Recv(nil), ErrInjectedRecv)
+	assert.Nil(f.Recv(nil))
+
+	f.PanicSend(1)
+	assert.PanicsWithValue(ErrInjectedSend, func() { _ = f.Send(nil) })
+	f.PanicRecv(1)
+	assert.PanicsWithValue(ErrInjectedRecv, func() { _ = f.Recv(nil) })
+
+	f.SetLatency(time.Millisecond*20, 0)
+	start := time.Now()
+	assert.Nil(f.Send(nil))
+	assert.GreaterOrEqual(time.Since(start), time.Millisecond*20)
+
+	f.FailSend(5)
+	f.Reset()
+	assert.Nil(f.Send(nil))
+
+	assert.Equal(f.Sent(), 7)
+	assert.Equal(f.Received(), 4)
+}
+
+func TestEventually(t *testing.T) {
+	assert := A.New(t)
+
+	n := 0
+	ok := Eventually(t, func() bool {
+		n++
+		return n == 3
+	}, time.Second, func() string { return "never" })
+
+	assert.True(ok)
+	assert.Equal(n, 3)
+
+	s := sock.New(sock.WithType("PUSH"), sock.WithEndpoint(Endpoint()))
+	assert.True(AssertCounters(t, s, 0, 0, 0))
+	assert.True(WaitDrained(t, s, time.Second))
+}
+
+func TestPairRetry(t *testing.T) {
+	p := NewPair(t, "PUSH/PULL", sock.WithRetryInterval(time.Millisecond*10))
+
+	p.SenderFaults.FailSend(2)
+	p.Sender.GetInChannel() <- []byte("hello")
+
+	WaitRecv(t, p.Receiver, 1, time.Second)
+	WaitDrained(t, p.Sender, time.Second)
+	AssertCounters(t, p.Sender, 1, 0, 0)
+
+	A.Equal(t, p.SenderFaults.Sent(), 3)
+	A.Equal(t, <-p.Receiver.GetOutChannel(), []byte("hello"))
+}
+
+func TestPairDisconnect(t *testing.T) {
+	p := NewPair(t, "PUSH/PULL")
+
+	p.ReceiverFaults.FailRecv(1)
+	p.Sender.GetInChannel() <- []byte("lost")
+	p.Sender.GetInChannel() <- []byte("kept")
+
+	WaitRecv(t, p.Receiver, 1, time.Second)
+	A.Equal(t, <-p.Receiver.GetOutChannel(), []byte("kept"))
+
+	// both return after the endpoint is detached and attached again by the loop of Sender
+	A.Nil(t, p.Disconnect())
+	A.Equal(t, p.Sender.GetEndpoints(), []sock.EndpointSpec{})
+	A.Nil(t, p.Reconnect())
+
+	p.Sender.GetInChannel() <- []byte("again")
+	WaitRecv(t, p.Receiver, 2, time.Second)
+	A.Equal(t, <-p.Receiver.GetOutChannel(), []byte("again"))
+}
+
+func TestPairPanic(t *testing.T) {
+	p := NewPair(t, "PUSH/PULL", sock.WithAutoRestart())
+
+	// the msg crashing the loop of Sender is lost, the loop restarted sends the next one
+	p.SenderFaults.PanicSend(1)
+	p.Sender.GetInChannel() <- []byte("crash")
+	p.Sender.GetInChannel() <- []byte("hello")
+
+	WaitRecv(t, p.Receiver, 1, time.Second)
+	A.Equal(t, p.SenderFaults.Sent(), 2)
+	A.Equal(t, <-p.Receiver.GetOutChannel(), []byte("hello"))
+}
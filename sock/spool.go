@@ -0,0 +1,481 @@
+package sock
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/rs/xid"
+	"github.com/zeromq/goczmq"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultSpoolSegmentSize = int64(64 << 20)
+
+	spoolSegmentPrefix = "segment-"
+	spoolSegmentSuffix = ".log"
+	spoolOffsetSuffix  = ".offset"
+	spoolHeaderSize    = 8
+)
+
+var endpointReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+/*
+Spool is an append-only segment log on disk which keeps msg can not be sent. each record of segment is
+
+	| 4 bytes payload length | 4 bytes crc32 of payload | payload |
+
+segment is rotated when its size reaches segmentSize. Replay reads segments in order and removes them
+after all records be replayed. the offset of the first record not replayed is kept in a file next to its
+segment, so records replayed are never replayed again.
+
+	every record is written through to the file by Write, so it survives a crash of process. it is synced to
+	disk by Flush, rotation and Close
+*/
+type Spool struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+	seq  uint64
+}
+
+// NewSpool opens the spool in dir, dir will be created when it is not exist
+func NewSpool(dir string, segmentSize int64) (*Spool, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSpoolSegmentSize
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	sp := &Spool{dir: dir, segmentSize: segmentSize}
+
+	segments, err := sp.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(segments) > 0 {
+		sp.seq = segments[len(segments)-1]
+	}
+
+	return sp, nil
+}
+
+// spoolDir gets the spool directory of key under dir
+func spoolDir(dir string, key string) string {
+	return filepath.Join(dir, endpointReplacer.ReplaceAllString(key, "_"))
+}
+
+// segmentName gets the file name of segment
+func (sp *Spool) segmentName(seq uint64) string {
+	return filepath.Join(sp.dir, fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, seq, spoolSegmentSuffix))
+}
+
+// segments lists sequence of all segments in order
+func (sp *Spool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(sp.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, spoolSegmentPrefix) || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+
+		var seq uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, spoolSegmentPrefix), spoolSegmentSuffix), "%d", &seq); err != nil {
+			continue
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	return seqs, nil
+}
+
+// rotate closes current segment and opens a new one
+func (sp *Spool) rotate() error {
+	if err := sp.closeSegment(); err != nil {
+		return err
+	}
+
+	sp.seq++
+
+	f, err := os.OpenFile(sp.segmentName(sp.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	sp.f = f
+	sp.w = bufio.NewWriter(f)
+	sp.size = 0
+
+	return nil
+}
+
+// closeSegment flushes and closes current segment
+func (sp *Spool) closeSegment() error {
+	if sp.f == nil {
+		return nil
+	}
+
+	f, w := sp.f, sp.w
+	sp.f, sp.w = nil, nil
+
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Write appends msg to spool
+func (sp *Spool) Write(msg []byte) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.f == nil || sp.size >= sp.segmentSize {
+		if err := sp.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var header [spoolHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(msg)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(msg))
+
+	if _, err := sp.w.Write(header[:]); err != nil {
+		return err
+	}
+
+	if _, err := sp.w.Write(msg); err != nil {
+		return err
+	}
+
+	sp.size += int64(spoolHeaderSize + len(msg))
+
+	// msg is spooled at runtime when retries run out, it must not wait in buffer until exit
+	return sp.w.Flush()
+}
+
+// Flush flushes buffered records into disk
+func (sp *Spool) Flush() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.w == nil {
+		return nil
+	}
+
+	if err := sp.w.Flush(); err != nil {
+		return err
+	}
+
+	return sp.f.Sync()
+}
+
+// offsetName gets the file name of the replay offset of segment
+func (sp *Spool) offsetName(seq uint64) string {
+	return sp.segmentName(seq) + spoolOffsetSuffix
+}
+
+// readOffset gets the replay offset of segment, zero when segment is never replayed
+func (sp *Spool) readOffset(seq uint64) int64 {
+	buf, err := os.ReadFile(sp.offsetName(seq))
+	if err != nil || len(buf) != 8 {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(buf))
+}
+
+// writeOffset keeps the replay offset of segment
+func (sp *Spool) writeOffset(seq uint64, offset int64) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(offset))
+
+	return os.WriteFile(sp.offsetName(seq), buf[:], 0644)
+}
+
+/*
+Replay calls f with every msg in spool in the order they were written. a segment is removed after all of its
+records be replayed, Replay stops at the first error returned by f and keeps the rest records.
+
+	a corrupted record stops the replay of its segment, the rest records of that segment are dropped
+	f must not write to the same spool
+*/
+func (sp *Spool) Replay(f func(msg []byte) error) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if err := sp.closeSegment(); err != nil {
+		return err
+	}
+
+	segments, err := sp.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, seq := range segments {
+		offset, err := sp.replaySegment(sp.segmentName(seq), sp.readOffset(seq), f)
+		if err != nil {
+			if werr := sp.writeOffset(seq, offset); werr != nil {
+				log.Error().Err(werr).Uint64("segment", seq).Msg("failed to keep spool offset")
+			}
+
+			return err
+		}
+
+		if err := os.Remove(sp.segmentName(seq)); err != nil {
+			return err
+		}
+
+		if err := os.Remove(sp.offsetName(seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaySegment calls f with every record in segment from offset, returns the offset of the first record not replayed
+func (sp *Spool) replaySegment(name string, offset int64, f func(msg []byte) error) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return offset, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	r := bufio.NewReader(file)
+	for {
+		var header [spoolHeaderSize]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+
+			log.Error().Err(err).Str("segment", name).Msg("truncated spool record header")
+			return offset, nil
+		}
+
+		msg := make([]byte, binary.BigEndian.Uint32(header[:4]))
+		if _, err := io.ReadFull(r, msg); err != nil {
+			log.Error().Err(err).Str("segment", name).Msg("truncated spool record")
+			return offset, nil
+		}
+
+		if crc32.ChecksumIEEE(msg) != binary.BigEndian.Uint32(header[4:]) {
+			log.Error().Str("segment", name).Msg("corrupted spool record")
+			return offset, nil
+		}
+
+		if err := f(msg); err != nil {
+			return offset, err
+		}
+
+		offset += int64(spoolHeaderSize + len(msg))
+	}
+}
+
+// Len gets the count of segments in spool
+func (sp *Spool) Len() int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	segments, err := sp.segments()
+	if err != nil {
+		return 0
+	}
+
+	return len(segments)
+}
+
+// Close flushes and closes the spool
+func (sp *Spool) Close() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	return sp.closeSegment()
+}
+
+/*
+WithSpool keeps msg which can not be sent in the spool under dir, one spool directory per endpoint list, the
+ID of socket is used when it has no endpoint. msg dropped after max retry or left in buffer when
+ExitWaitTimeout expires goes to spool, and is replayed when Publisher on the same endpoints starts next time.
+spool is opened by Attach, its error is returned from there.
+
+	PUB socket drops msg when no subscriber is connected, so PUB replays spool when its first peer connected
+	by socket monitor, which is enabled with spool. a new subscriber may still miss msg sent before its
+	subscription arrives, spool only guarantees delivery on PUSH
+*/
+func WithSpool(dir string) Option {
+	return func(s *Sock) {
+		s.spoolDir = dir
+	}
+}
+
+// initSpool enables socket monitor which replays spool of PUB socket, it is called after all options
+func (s *Sock) initSpool() {
+	if s.spoolDir != "" && s.Type == goczmq.Pub {
+		s.monitor.enabled = true
+	}
+}
+
+// spoolKey gets the name of spool directory of socket, it is all endpoints or the ID of socket without endpoint
+func (s *Sock) spoolKey() string {
+	if key := s.endpointAddrs(); key != "" {
+		return key
+	}
+
+	return s.ID
+}
+
+// openSpool opens spool of socket once when spool is enabled
+func (s *Sock) openSpool() error {
+	if s.spoolDir == "" || s.spool != nil {
+		return nil
+	}
+
+	sp, err := NewSpool(spoolDir(s.spoolDir, s.spoolKey()), 0)
+	if err != nil {
+		return fmt.Errorf("failed to open spool: %w", err)
+	}
+
+	s.spool = sp
+
+	return nil
+}
+
+// peerConnected replays spool of PUB socket when its first peer connected, it is called in the monitor thread
+func (s *Sock) peerConnected() {
+	if s.spool == nil || s.Type != goczmq.Pub {
+		return
+	}
+
+	if err := s.control(func(_ *goczmq.Sock) { s.replaySpool() }); err != nil {
+		log.Warn().Err(err).Msg("failed to replay spool on peer connected")
+	}
+}
+
+// spoolMsg writes msg into spool, returns false when spool is not enabled or msg failed to write
+func (s *Sock) spoolMsg(msg []byte) bool {
+	if s.spool == nil {
+		return false
+	}
+
+	if err := s.spool.Write(msg); err != nil {
+		log.Error().Err(err).Bytes("data", msg).Msg("failed to write spool")
+		return false
+	}
+
+	return true
+}
+
+// drainBuffer moves msg left in 'in', 'retryCh' channel, retry queue and batch into spool or dead letter. msg of
+// 'in' channel and lanes is wrapped as it is sent, so spool and dead letter always get msg as it is on the wire
+func (s *Sock) drainBuffer() {
+	if s.spool == nil && s.deadLetter == nil {
+		return
+	}
+
+	for {
+		select {
+		case buf := <-s.in:
+			s.lost(s.wrap(buf, xid.NilID()), ErrExitWaitTimeout, 0)
+		case r := <-s.retryCh:
+			s.lost(r.Msg, ErrExitWaitTimeout, r.GetRetryTimes())
+		default:
+			for _, r := range s.delayed.drain() {
+				s.lost(r.Msg, ErrExitWaitTimeout, r.GetRetryTimes())
+			}
+
+			for _, f := range s.acks.drain() {
+				s.lost(f.msg, ErrExitWaitTimeout, f.attempts)
+			}
+
+			for _, msg := range s.lanes.drain() {
+				s.lost(s.wrap(msg, xid.NilID()), ErrExitWaitTimeout, 0)
+			}
+
+			for _, msg := range s.batch.take() {
+				s.lost(msg, ErrExitWaitTimeout, 0)
+			}
+
+			if s.spool == nil {
+				return
+			}
+
+			if err := s.spool.Flush(); err != nil {
+				log.Error().Err(err).Msg("failed to flush spool")
+			}
+			return
+		}
+	}
+}
+
+// replaySpool sends msg in spool in order, the rest msg are kept in spool when an error occurred. with WithAck,
+// msg replayed is kept in flight until acked like msg sent
+func (s *Sock) replaySpool() {
+	if s.spool == nil {
+		return
+	}
+
+	err := s.spool.Replay(func(msg []byte) error {
+		if s.acks.tracking() {
+			s.track(msg)
+			s.sendTracked(msg)
+			return nil
+		}
+
+		frames, err := s.frames(msg)
+		if err != nil {
+			log.Error().Err(err).Bytes("data", msg).Msg("drop malformed msg in spool")
+			s.dead(msg, err, 0)
+			return nil
+		}
+
+		if err := s.send(s.soc, frames); err != nil {
+			return err
+		}
+
+		s.sendMsgCount.Add(1)
+		return nil
+	})
+
+	if err != nil {
+		log.Error().Err(err).Msg("failed to replay spool")
+	}
+}
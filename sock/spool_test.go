@@ -0,0 +1,161 @@
+package sock
+
+import (
+	"fmt"
+	A "github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	assert := A.New(t)
+
+	dir := spoolDir(t.TempDir(), "tcp://127.0.0.1:5555")
+
+	sp, err := NewSpool(dir, 64)
+	assert.Nil(err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(sp.Write([]byte(strconv.Itoa(i))))
+	}
+
+	assert.Nil(sp.Close())
+	assert.True(sp.Len() > 1)
+
+	// reopen spool like a restarted process
+	sp, err = NewSpool(dir, 64)
+	assert.Nil(err)
+	assert.Nil(sp.Write([]byte("100")))
+
+	msgs := make([]string, 0)
+	assert.Nil(sp.Replay(func(msg []byte) error {
+		msgs = append(msgs, string(msg))
+		return nil
+	}))
+
+	assert.Equal(len(msgs), 101)
+	for i, msg := range msgs {
+		assert.Equal(msg, strconv.Itoa(i))
+	}
+
+	assert.Equal(sp.Len(), 0)
+}
+
+func TestSpoolReplayError(t *testing.T) {
+	assert := A.New(t)
+
+	sp, err := NewSpool(t.TempDir(), 0)
+	assert.Nil(err)
+
+	assert.Nil(sp.Write([]byte("a")))
+	assert.Nil(sp.Write([]byte("b")))
+
+	err = sp.Replay(func(msg []byte) error {
+		return fmt.Errorf("send failed")
+	})
+	assert.NotNil(err)
+	assert.Equal(sp.Len(), 1)
+
+	msgs := make([]string, 0)
+	assert.Nil(sp.Replay(func(msg []byte) error {
+		msgs = append(msgs, string(msg))
+		return nil
+	}))
+	assert.Equal(msgs, []string{"a", "b"})
+}
+
+func TestSpoolCorrupted(t *testing.T) {
+	assert := A.New(t)
+
+	sp, err := NewSpool(t.TempDir(), 0)
+	assert.Nil(err)
+
+	assert.Nil(sp.Write([]byte("a")))
+	assert.Nil(sp.Write([]byte("b")))
+	assert.Nil(sp.Close())
+
+	name := sp.segmentName(sp.seq)
+	buf, err := os.ReadFile(name)
+	assert.Nil(err)
+
+	// flip the payload of the second record
+	buf[len(buf)-1] ^= 0xff
+	assert.Nil(os.WriteFile(name, buf, 0644))
+
+	msgs := make([]string, 0)
+	assert.Nil(sp.Replay(func(msg []byte) error {
+		msgs = append(msgs, string(msg))
+		return nil
+	}))
+	assert.Equal(msgs, []string{"a"})
+}
+
+func TestSpoolReplayOffset(t *testing.T) {
+	assert := A.New(t)
+
+	dir := t.TempDir()
+	sp, err := NewSpool(dir, 0)
+	assert.Nil(err)
+
+	for _, msg := range []string{"a", "b", "c"} {
+		assert.Nil(sp.Write([]byte(msg)))
+	}
+
+	// the send of 'b' fails, 'a' is never replayed again
+	msgs := make([]string, 0)
+	err = sp.Replay(func(msg []byte) error {
+		if string(msg) == "b" {
+			return fmt.Errorf("send failed")
+		}
+
+		msgs = append(msgs, string(msg))
+		return nil
+	})
+	assert.NotNil(err)
+	assert.Equal(msgs, []string{"a"})
+
+	// offset is kept across restart
+	sp, err = NewSpool(dir, 0)
+	assert.Nil(err)
+
+	assert.Nil(sp.Replay(func(msg []byte) error {
+		msgs = append(msgs, string(msg))
+		return nil
+	}))
+	assert.Equal(msgs, []string{"a", "b", "c"})
+	assert.Equal(sp.Len(), 0)
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(err)
+	assert.Equal(len(entries), 0)
+}
+
+func TestSpoolOpen(t *testing.T) {
+	assert := A.New(t)
+
+	dir := t.TempDir()
+
+	// sockets sharing the first endpoint do not share spool
+	a := New(WithType("Push"), WithBind("tcp://*:5555", "tcp://*:5556"), WithSpool(dir))
+	b := New(WithType("Push"), WithBind("tcp://*:5555"), WithSpool(dir))
+	assert.Nil(a.spool)
+
+	assert.Nil(a.openSpool())
+	assert.Nil(b.openSpool())
+	assert.NotEqual(a.spool.dir, b.spool.dir)
+
+	// record is written through without Flush
+	assert.Nil(a.spool.Write([]byte("a")))
+	info, err := os.Stat(a.spool.segmentName(a.spool.seq))
+	assert.Nil(err)
+	assert.Equal(info.Size(), int64(spoolHeaderSize+1))
+
+	// error of open is returned instead of panic
+	file := filepath.Join(dir, "file")
+	assert.Nil(os.WriteFile(file, nil, 0644))
+
+	c := New(WithType("Push"), WithEndpoint("tcp://*:5555"), WithSpool(file))
+	assert.NotNil(c.openSpool())
+}
@@ -0,0 +1,116 @@
+package sock
+
+import (
+	"github.com/zeromq/goczmq"
+	"sort"
+)
+
+// NewTopicMsg creates a multipart msg with topic as the first frame, it works with WithMultipart on PUB socket
+func NewTopicMsg(topic string, msg []byte) []byte {
+	return NewMessage([]byte(topic), msg).Bytes()
+}
+
+// WithTopic prefixes each msg sent by socket with a topic frame, SUB socket filters msg by the topic frame.
+// it only works on PUB/XPUB socket
+func WithTopic(topic string) Option {
+	return func(s *Sock) {
+		s.topic = topic
+	}
+}
+
+// WithSubscribe subscribes topics on SUB socket. SUB socket subscribes all msg when no topic is set
+func WithSubscribe(topics ...string) Option {
+	return func(s *Sock) {
+		for _, topic := range topics {
+			s.topics[topic] = struct{}{}
+		}
+	}
+}
+
+// Subscribe adds topic into subscription of SUB socket, it takes effect at runtime. ErrClosed is returned when
+// socket has been released
+func (s *Sock) Subscribe(topic string) error {
+	s.mu.Lock()
+	s.topics[topic] = struct{}{}
+	s.mu.Unlock()
+
+	return s.control(s.syncSubscribe)
+}
+
+// Unsubscribe removes topic from subscription of SUB socket, it takes effect at runtime. SUB socket
+// subscribes all msg again when the last topic is removed. ErrClosed is returned when socket has been released
+func (s *Sock) Unsubscribe(topic string) error {
+	s.mu.Lock()
+	delete(s.topics, topic)
+	s.mu.Unlock()
+
+	return s.control(s.syncSubscribe)
+}
+
+// GetTopics gets the topics subscribed
+func (s *Sock) GetTopics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+
+	return topics
+}
+
+// syncSubscribe makes the subscription of socket equal to topics. zeromq subscription is reference counted,
+// so only the difference is applied
+func (s *Sock) syncSubscribe(soc *goczmq.Sock) {
+	if soc == nil || soc.GetType() != goczmq.Sub {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := make(map[string]struct{}, len(s.topics)+1)
+	for topic := range s.topics {
+		want[topic] = struct{}{}
+	}
+
+	if len(want) == 0 {
+		want[""] = struct{}{}
+	}
+
+	for topic := range s.subscribed {
+		if _, ok := want[topic]; !ok {
+			log.Debug().Str("topic", topic).Msg("unsubscribe")
+			soc.SetUnsubscribe(topic)
+			delete(s.subscribed, topic)
+		}
+	}
+
+	for topic := range want {
+		if _, ok := s.subscribed[topic]; !ok {
+			log.Debug().Str("topic", topic).Msg("subscribe")
+			soc.SetSubscribe(topic)
+			s.subscribed[topic] = struct{}{}
+		}
+	}
+}
+
+// control queues f to run in the thread which owns the zeromq socket without waiting for it, it blocks while the
+// control buffer is full until socket is released or its ctx is done
+func (s *Sock) control(f func(soc *goczmq.Sock)) error {
+	if s.IsClosed() {
+		return ErrClosed
+	}
+
+	select {
+	case s.ctl <- f:
+		return nil
+	case <-s.done:
+		return ErrClosed
+	case <-s.ctx.Done():
+		return ctxErr(s.ctx)
+	}
+}
@@ -0,0 +1,190 @@
+package sock
+
+import (
+	"context"
+	"fmt"
+	"github.com/zeromq/goczmq"
+	"reflect"
+)
+
+const DefaultErrBufferSize = 100
+
+// CodecError is sent into the error channel of TypedSock when a value fails to encode or a msg fails to decode
+type CodecError struct {
+	Msg []byte
+	Err error
+}
+
+func (e *CodecError) Error() string {
+	return fmt.Sprintf("codec: %s", e.Err.Error())
+}
+
+func (e *CodecError) Unwrap() error {
+	return e.Err
+}
+
+/*
+TypedSock wraps Sock with a Codec, values put into In are encoded before sending and msg received are decoded
+into values of Out. codec failures are sent into Errors instead of panicking.
+
+	optional socket type: PUB/PUSH/SUB/PULL/DEALER, the run loop of Sock must be started by caller. with
+	WithEnvelope, the Body of msg received is decoded, msg without a valid Envelope is reported as CodecError
+*/
+type TypedSock[T any] struct {
+	s     *Sock
+	codec Codec
+	in    chan T
+	out   chan T
+	errs  chan error
+}
+
+// NewTypedSock creates a TypedSock on s, channels have the same buffer size as s
+func NewTypedSock[T any](s *Sock, codec Codec) *TypedSock[T] {
+	switch s.Type {
+	case goczmq.Pub, goczmq.Push, goczmq.Sub, goczmq.Pull, goczmq.Dealer:
+	default:
+		panic(fmt.Errorf("typed sock only enables by 'type': Pub/Push/Sub/Pull/Dealer"))
+	}
+
+	t := &TypedSock[T]{
+		s:     s,
+		codec: codec,
+		in:    make(chan T, s.MaxBufferSize),
+		out:   make(chan T, s.MaxBufferSize),
+		errs:  make(chan error, DefaultErrBufferSize),
+	}
+
+	switch s.Type {
+	case goczmq.Pub, goczmq.Push:
+		Pool.CtxGo(s.ctx, t.encodeLoop)
+	case goczmq.Sub, goczmq.Pull:
+		Pool.CtxGo(s.ctx, t.decodeLoop)
+	default:
+		Pool.CtxGo(s.ctx, t.encodeLoop)
+		Pool.CtxGo(s.ctx, t.decodeLoop)
+	}
+
+	return t
+}
+
+// GetSock gets the wrapped Sock
+func (t *TypedSock[T]) GetSock() *Sock {
+	return t.s
+}
+
+// In gets the channel of values to send
+func (t *TypedSock[T]) In() chan<- T {
+	return t.in
+}
+
+// Out gets the channel of values received, it is closed when Sock released
+func (t *TypedSock[T]) Out() <-chan T {
+	return t.out
+}
+
+// Errors gets the channel of codec errors, error is dropped when channel is full
+func (t *TypedSock[T]) Errors() <-chan error {
+	return t.errs
+}
+
+// Send encodes v and sends it by Sock.Send
+func (t *TypedSock[T]) Send(ctx context.Context, v T) error {
+	buf, err := t.codec.Marshal(v)
+	if err != nil {
+		return &CodecError{Err: err}
+	}
+
+	return t.s.Send(ctx, buf)
+}
+
+// Recv gets one value from Out
+func (t *TypedSock[T]) Recv(ctx context.Context) (T, error) {
+	var zero T
+
+	select {
+	case v, ok := <-t.out:
+		if !ok {
+			return zero, ErrClosed
+		}
+
+		return v, nil
+	case <-ctx.Done():
+		return zero, ctxErr(ctx)
+	}
+}
+
+// decode decodes msg into a new value, pointer type T is allocated before decoding
+func (t *TypedSock[T]) decode(buf []byte) (T, error) {
+	var v T
+
+	if typ := reflect.TypeOf(v); typ != nil && typ.Kind() == reflect.Pointer {
+		v = reflect.New(typ.Elem()).Interface().(T)
+		return v, t.codec.Unmarshal(buf, v)
+	}
+
+	return v, t.codec.Unmarshal(buf, &v)
+}
+
+// report sends err into error channel without blocking
+func (t *TypedSock[T]) report(err error) {
+	select {
+	case t.errs <- err:
+	default:
+		log.Error().Err(err).Msg("typed sock error channel is full, drop error")
+	}
+}
+
+// encodeLoop encodes values of In into 'in' channel of Sock
+func (t *TypedSock[T]) encodeLoop() {
+	for {
+		select {
+		case <-t.s.ctx.Done():
+			return
+		case v := <-t.in:
+			buf, err := t.codec.Marshal(v)
+			if err != nil {
+				t.report(&CodecError{Err: err})
+				continue
+			}
+
+			if err := t.s.Put(buf); err != nil {
+				log.Error().Err(err).Msg("typed sock failed to put msg")
+			}
+		}
+	}
+}
+
+// decodeLoop decodes msg of 'out' channel of Sock into Out until Sock released
+func (t *TypedSock[T]) decodeLoop() {
+	defer close(t.out)
+
+	for buf := range t.s.out {
+		body := buf
+		if t.s.envelope {
+			e, err := t.s.unwrap(buf)
+			if err != nil {
+				t.report(&CodecError{Msg: buf, Err: err})
+				continue
+			}
+
+			body = e.Body
+		}
+
+		v, err := t.decode(body)
+		if err != nil {
+			t.report(&CodecError{Msg: buf, Err: err})
+			continue
+		}
+
+		select {
+		case t.out <- v:
+		case <-t.s.ctx.Done():
+			// keep draining 'out' channel of Sock while it is releasing
+			select {
+			case t.out <- v:
+			default:
+				log.Error().Msg("typed sock out channel is full on exit, drop value")
+			}
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"github.com/lafrinte/nops/atom"
 	"github.com/lafrinte/nops/timer"
+	"github.com/rs/xid"
 	"github.com/zeromq/goczmq"
 	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +18,8 @@ type RetryMsg struct {
 	retry    uint8
 	Msg      []byte
 	MaxRetry uint8
+	err      error
+	due      time.Time
 }
 
 // Retry get the retry state. if the retry time reach the max retry times, Retry will return false.
@@ -32,6 +37,11 @@ func (r *RetryMsg) GetRetryTimes() uint8 {
 	return r.retry
 }
 
+// GetLastErr gets the error of the last send attempt
+func (r *RetryMsg) GetLastErr() error {
+	return r.err
+}
+
 func NewRetryMsg(msg []byte, retry uint8) *RetryMsg {
 	if retry == 0 {
 		retry = DefaultRetryAttempts
@@ -50,11 +60,65 @@ type Sock struct {
 	out           chan []byte
 	MaxBufferSize int
 
+	// policy applied when channel is full
+	inOverflow  overflow
+	outOverflow overflow
+
 	// socket connection args
-	Type     int
-	Endpoint string
-	attach   bool
-	Sndhwm   int
+	Type      int
+	Endpoint  string
+	attach    bool
+	endpoints []EndpointSpec
+	attached  map[string]EndpointSpec
+	// endpoints are attached by the run loop, so runtime changes are applied in its thread
+	live      bool
+	discovery *Discovery
+	service   string
+	unwatch   func()
+	Sndhwm    int
+	Identity  string
+
+	// endpoints of service discovered by the latest beacons, true when alive. it is guarded by mu and applied
+	// by syncDiscovered one at a time
+	discovered map[string]bool
+	syncing    sync.Mutex
+
+	// exchange Message instead of single frame through channels
+	multipart bool
+
+	// frames between identity and body sent by ROUTER peers, e.g. the delimiter and request id of REQ, they are
+	// sent back before body of reply
+	routes map[string][][]byte
+
+	// envelope args
+	envelope      bool
+	producerID    string
+	schemaVersion uint16
+
+	// sequence number of msg sent, and deduplication of msg received
+	sequence bool
+	seq      atomic.Uint64
+	epoch    uint64
+	dedupe   *sequencer
+
+	// pub/sub topic args
+	mu         sync.Mutex
+	topic      string
+	topics     map[string]struct{}
+	subscribed map[string]struct{}
+
+	// runs func in the thread owning socket
+	ctl chan func(soc *goczmq.Sock)
+
+	// closed when socket is released
+	closed atom.AtomicBool
+	done   chan struct{}
+
+	// curve args
+	curveServer    bool
+	curveCert      *CurveCert
+	curveServerKey string
+	curveAllow     []string
 
 	// reconnect args
 	DisableRestart         atom.AtomicBool
@@ -75,29 +139,54 @@ type Sock struct {
 	retryCh       chan *RetryMsg
 	RetryInterval time.Duration
 	RetryAttempts uint8
+	backoff       Backoff
+	delayed       *retryQueue
+
+	// batching and compression of Publisher
+	batch *batcher
+
+	// priority input lanes of Publisher
+	lanes *laneSet
+
+	// app-level acks of PUSH/PULL
+	acks *acker
+
+	// rate limit of Publisher and the measured send rate
+	limiter  *rateLimiter
+	sendRate *rateMeter
 
-	//
-	sendMsgCount uint64
-	dropMsgCount uint64
-	recvMsgCount uint64
+	// msg counters, safe for concurrent use
+	sendMsgCount atomic.Uint64
+	dropMsgCount atomic.Uint64
+	recvMsgCount atomic.Uint64
+
+	// spool keeps msg can not be sent on disk
+	spoolDir string
+	spool    *Spool
+
+	// handler of msg which failed to send for good
+	deadLetter DeadLetter
+
+	// socket monitor
+	monitor monitorState
+
+	// failures injected into socket io
+	fault Fault
 
 	// safe destroy args
 	ExitWaitTimeout time.Duration
+	// upper bound of ExitWaitTimeout set by Manager on stop in nanoseconds, zero is unbounded
+	exitWaitLimit atomic.Int64
+
+	// run loop is restarted by recovery, set by WithAutoRestart and Manager
+	autoRestart bool
+	// called before the run loop is restarted by recovery
+	onRestart func()
 
 	SendTimeoutSec uint16
 	RecvTimeoutSec uint16
 }
 
-// bind binds socket on endpoint
-func (s *Sock) bind() (*goczmq.Sock, error) {
-	soc := s.setOptions()
-	if _, err := soc.Bind(s.Endpoint); err != nil {
-		return nil, err
-	}
-
-	return soc, nil
-}
-
 // connect makes connection to endpoint
 func (s *Sock) connect() (*goczmq.Sock, error) {
 	soc := s.setOptions()
@@ -114,17 +203,41 @@ func (s *Sock) setOptions() *goczmq.Sock {
 
 	soc.SetSndhwm(s.Sndhwm)
 
+	// attach monitor before bind or connect, so LISTENING and CONNECTED events are not missed
+	s.startMonitor(soc)
+
+	if s.Identity != "" {
+		soc.SetIdentity(s.Identity)
+	}
+
+	s.setCurve(soc)
+
+	if soc.GetType() == goczmq.Router {
+		// report unroutable msg as send error instead of dropping it silently
+		soc.SetRouterMandatory(1)
+	}
+
 	if soc.GetType() == goczmq.Sub {
-		log.Debug().Msg("sub mode will set default subscribe to ''")
-		soc.SetSubscribe("")
+		// new socket has no subscription, sub mode will set default subscribe to '' when no topic is set
+		s.mu.Lock()
+		s.subscribed = make(map[string]struct{})
+		s.mu.Unlock()
+
+		s.syncSubscribe(soc)
 	}
 
 	if s.SendTimeoutSec > 0 {
-		soc.SetSndtimeo(int(s.SendTimeoutSec * 1000))
+		soc.SetSndtimeo(int(s.SendTimeoutSec) * 1000)
 	}
 
 	if s.RecvTimeoutSec > 0 {
-		soc.SetRcvtimeo(int(s.SendTimeoutSec * 1000))
+		soc.SetRcvtimeo(int(s.RecvTimeoutSec) * 1000)
+	}
+
+	if soc.GetType() == goczmq.Req {
+		// a new request can be sent after a reply is lost, the late reply of an old request is dropped by request id
+		soc.SetReqRelaxed(1)
+		soc.SetReqCorrelate(1)
 	}
 
 	if s.EnableTcpKeepAlive {
@@ -159,19 +272,31 @@ func (s *Sock) setOptions() *goczmq.Sock {
 /*
 Attach attaches a socket to zero or more endpoints.
 
-	call bind when attach is equal to false
-	call connect when attach is equal to true
+	bind or connect every endpoint by its own mode, WithEndpoint is bound when attach is equal to false
+	and connected when attach is equal to true. spool set by WithSpool is opened before socket is created
 */
 func (s *Sock) Attach() (*goczmq.Sock, error) {
-	if s.attach {
-		return s.connect()
+	if err := s.openSpool(); err != nil {
+		return nil, err
 	}
 
-	return s.bind()
+	soc := s.setOptions()
+
+	// new socket has no endpoint attached
+	s.mu.Lock()
+	s.attached = make(map[string]EndpointSpec)
+	s.live = true
+	s.mu.Unlock()
+
+	if err := s.attachEndpoints(soc); err != nil {
+		return nil, err
+	}
+
+	return soc, nil
 }
 
 func (s *Sock) EmptyBuffer() bool {
-	return (len(s.retryCh) + len(s.in) + len(s.out)) == 0
+	return (s.GetRetryCount() + len(s.in) + len(s.out) + s.batch.Len() + s.lanes.Len() + s.acks.Len()) == 0
 }
 
 // GetID gets the uniq it of socket
@@ -189,29 +314,30 @@ func (s *Sock) GetOutCount() int {
 	return len(s.out)
 }
 
-// GetRetryCount gets msg count int channel 'retryCh'
+// GetRetryCount gets msg count int channel 'retryCh' and msg waiting backoff delay
 func (s *Sock) GetRetryCount() int {
-	return len(s.retryCh)
+	return len(s.retryCh) + s.delayed.Len()
 }
 
 // GetDropMsgCount gets the total count of msg sock has dropped ever
 func (s *Sock) GetDropMsgCount() uint64 {
-	return s.dropMsgCount
+	return s.dropMsgCount.Load()
 }
 
 // GetRecvMsgCount gets the total count of msg sock has received
 func (s *Sock) GetRecvMsgCount() uint64 {
-	return s.recvMsgCount
+	return s.recvMsgCount.Load()
 }
 
 // GetSendMsgCount gets the total count of msg sock has published
 func (s *Sock) GetSendMsgCount() uint64 {
-	return s.sendMsgCount
+	return s.sendMsgCount.Load()
 }
 
-// IsAutoRestart gets the value of DisableRestart
+// IsAutoRestart reports whether the run loop is restarted on panic, it is enabled by WithAutoRestart and stopped
+// by DisableRestart
 func (s *Sock) IsAutoRestart() bool {
-	return s.DisableRestart.True()
+	return s.autoRestart && !s.DisableRestart.True()
 }
 
 // StopAutoRestart sets DisableRestart to true
@@ -224,14 +350,25 @@ func (s *Sock) GetInChannel() chan []byte {
 	return s.in
 }
 
-// GetOutChannel returns out channel
+// GetOutChannel returns out channel, msg keeps its Envelope when enabled, see Unwrap
 func (s *Sock) GetOutChannel() chan []byte {
 	return s.out
 }
 
 func (s *Sock) release() {
+	if !s.closed.CompareAndSwap(false, true) {
+		return
+	}
+
+	if s.unwatch != nil {
+		s.unwatch()
+	}
+
+	s.acks.close()
+	s.releaseCurve()
 
-	close(s.in)
+	// 'in' channel is written by callers of Put concurrently, so it is never closed and writers stop on done
+	close(s.done)
 	close(s.out)
 	close(s.retryCh)
 
@@ -239,6 +376,12 @@ func (s *Sock) release() {
 		s.soc.Destroy()
 		s.soc = nil
 	}
+
+	if s.spool != nil {
+		if err := s.spool.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close spool")
+		}
+	}
 }
 
 // sendFrame tries sending msg and puts msg into retry channel when any error occurred
@@ -251,86 +394,244 @@ func (s *Sock) sendFrame(sock *goczmq.Sock, msg []byte, retry bool) error {
 		return fmt.Errorf("sock pointer is nil")
 	}
 
-	err := sock.SendFrame(msg, goczmq.FlagNone)
+	frames, err := s.frames(msg)
+	if err != nil {
+		log.Error().Err(err).Bytes("data", msg).Msg("failed to build frames")
+		s.dead(msg, err, 0)
+
+		return err
+	}
+
+	err = s.send(sock, frames)
 	if err != nil {
 		log.Error().Err(err).Bytes("data", msg).Msg("failed to send")
 
 		if retry {
 			log.Info().Bytes("data", msg).Msg("retry send")
-			s.retryCh <- NewRetryMsg(msg, s.RetryAttempts)
+			r := NewRetryMsg(msg, s.RetryAttempts)
+			r.err = err
+			s.retryCh <- r
 
 			// not return error while msg can retry
 			return nil
 		}
 
-		s.dropMsgCount++
+		s.dead(msg, err, 0)
 
 		return fmt.Errorf("failed to send")
 	}
 
-	s.sendMsgCount++
+	s.sendMsgCount.Add(1)
 
 	return nil
 }
 
-// recvFrame tries receiving msg and puts into out channel
+// frames splits msg into the frames which will be sent on the wire
+func (s *Sock) frames(msg []byte) ([][]byte, error) {
+	if s.multipart {
+		m, err := ParseMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(m) == 0 {
+			return nil, fmt.Errorf("empty message")
+		}
+
+		if s.topic != "" {
+			return append([][]byte{[]byte(s.topic)}, m...), nil
+		}
+
+		return m, nil
+	}
+
+	if s.Type == goczmq.Router {
+		identity, body, err := SplitRouteMsg(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		// REQ peer expects the delimiter frame and request id it sent
+		frames := append([][]byte{identity}, s.routes[string(identity)]...)
+
+		return append(frames, body), nil
+	}
+
+	if s.topic != "" {
+		return [][]byte{[]byte(s.topic), msg}, nil
+	}
+
+	return [][]byte{msg}, nil
+}
+
+// sendFrames sends frames as one message, all frames except the last one are sent with flag 'more'
+func sendFrames(sock *goczmq.Sock, frames [][]byte) error {
+	for i, frame := range frames {
+		flag := goczmq.FlagNone
+		if i < len(frames)-1 {
+			flag = goczmq.FlagMore
+		}
+
+		if err := sock.SendFrame(frame, flag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+recvMsg receives all frames of one message from sock and converts them into the format of 'out' channel
+
+	multipart: Message.Bytes() of all frames
+	ROUTER:    NewRouteMsg() of identity frame and the last frame, the empty delimiter sent by REQ peer is
+	           remembered by identity and added back on reply
+	others:    the last frame, leading frames (e.g. the empty delimiter) are skipped
+*/
+func (s *Sock) recvMsg(sock *goczmq.Sock) ([]byte, error) {
+	frames, err := s.recv(sock)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("recv empty message")
+	}
+
+	body := frames[len(frames)-1]
+
+	// envelope of every msg in batch is checked after unpacking
+	if s.envelope && !s.isBatch(body) {
+		if _, err := ParseEnvelope(body); err != nil {
+			s.dropMsgCount.Add(1)
+			return nil, err
+		}
+	}
+
+	if s.multipart {
+		return Message(frames).Bytes(), nil
+	}
+
+	if s.Type == goczmq.Router {
+		if len(frames) < 2 {
+			return nil, fmt.Errorf("router got msg without identity frame")
+		}
+
+		if len(frames) >= 3 {
+			s.routes[string(frames[0])] = frames[1 : len(frames)-1]
+		} else {
+			delete(s.routes, string(frames[0]))
+		}
+
+		return NewRouteMsg(frames[0], body), nil
+	}
+
+	return body, nil
+}
+
+// recvFrame tries receiving one msg and puts into out channel
 func (s *Sock) recvFrame(sock *goczmq.Sock) error {
 	/* goczmq.Sock will panic in C while receiving or sending frame on a destroyed socket,
 	   wrapped in thread will transfer thread-panic to main thread and be caught
 	*/
-	for {
-		if sock == nil {
-			log.Error().Err(fmt.Errorf("sock pointer is nil")).Msg("sock may closed, exit now")
-			return fmt.Errorf("sock pointer is nil")
+	if sock == nil {
+		log.Error().Err(fmt.Errorf("sock pointer is nil")).Msg("sock may closed, exit now")
+		return fmt.Errorf("sock pointer is nil")
+	}
+
+	buf, err := s.recvMsg(sock)
+	if err != nil {
+		if err == goczmq.ErrRecvFrameAfterDestroy {
+			log.Error().Err(err).Msg("call RecvFrame after sock been destroyed")
+			panic(err)
 		}
 
-		buf, _, err := sock.RecvFrame()
-		if err != nil {
-			if err == goczmq.ErrRecvFrameAfterDestroy {
-				log.Error().Err(err).Msg("call RecvFrame after sock been destroyed")
-				panic(err)
-			}
+		log.Error().Err(err).Msg("RecvFrame failed")
 
-			log.Error().Err(err).Msg("RecvFrame failed")
+		return err
+	}
 
-			continue
+	if !s.isBatch(buf) {
+		s.deliver(buf)
+		return nil
+	}
+
+	msgs, err := ParseBatch(buf)
+	if err != nil {
+		s.dropMsgCount.Add(1)
+		log.Error().Err(err).Msg("drop malformed batch")
+		return err
+	}
+
+	for _, msg := range msgs {
+		if s.envelope {
+			if _, err := ParseEnvelope(msg); err != nil {
+				s.dropMsgCount.Add(1)
+				log.Error().Err(err).Msg("drop msg in batch")
+				continue
+			}
 		}
 
-		s.out <- buf
-		s.recvMsgCount++
+		s.deliver(msg)
 	}
+
+	return nil
 }
 
-// retry tries to publish msg in retry channel and re-puts into retry channel when any error occured
+// retry tries to publish msg in retry channel and re-puts into retry queue with backoff delay when any error occurred
 func (s *Sock) retry(sock *goczmq.Sock, msg *RetryMsg) {
 	if msg.Retry() {
-		if err := sock.SendFrame(msg.Msg, goczmq.FlagNone); err != nil {
+		frames, err := s.frames(msg.Msg)
+		if err != nil {
+			log.Error().Err(err).Bytes("data", msg.Msg).Msg("failed to build frames")
+			s.dead(msg.Msg, err, msg.GetRetryTimes())
+			return
+		}
+
+		if err := s.send(sock, frames); err != nil {
 			msg.IterRetryTimes()
+			msg.err = err
 
 			log.Error().Err(err).Bytes("data", msg.Msg).Msgf("retry SendFrame failed the %d time", msg.GetRetryTimes())
-			t := timer.AcquireTimer(s.RetryInterval)
-			if !t.Stop() {
-				<-t.C
-			}
 
-			timer.ReleaseTimer(t)
-
-			s.retryCh <- msg
+			// wait backoff delay in retry queue without blocking the socket thread
+			s.delayed.push(msg, s.backoff.Next(msg.GetRetryTimes()))
 			return
 		}
+
+		s.sendMsgCount.Add(1)
+		return
+	}
+
+	log.Error().Bytes("data", msg.Msg).Msgf("give up msg after retry %d times", msg.GetRetryTimes())
+	s.lost(msg.Msg, msg.GetLastErr(), msg.GetRetryTimes())
+}
+
+// exitWait gets ExitWaitTimeout bounded by the limit set by Manager
+func (s *Sock) exitWait() time.Duration {
+	if limit := time.Duration(s.exitWaitLimit.Load()); limit > 0 && limit < s.ExitWaitTimeout {
+		return limit
 	}
+
+	return s.ExitWaitTimeout
 }
 
 // Release tries release socket after all buffers be triggered
 func (s *Sock) Release() error {
 	s.StopAutoRestart()
 
+	// msg in batch and reorder buffer is not waiting for linger or delay on exit, msg waiting for rate limit is not
+	// sent
+	s.dropHeld()
+	s.flush()
+	s.put(s.dedupe.flush())
+
 	if s.EmptyBuffer() {
 		s.release()
 		return nil
 	}
 
-	exitWaitTimeout := time.After(s.ExitWaitTimeout)
+	exitWaitTimeout := time.After(s.exitWait())
 	for {
 		if s.EmptyBuffer() {
 			s.release()
@@ -339,13 +640,36 @@ func (s *Sock) Release() error {
 
 		select {
 		case <-exitWaitTimeout:
+			s.drainBuffer()
 			s.release()
-			msg := fmt.Sprintf("msg lost: in [%d] out [%d] retry [%d]", s.GetInCount(), s.GetOutCount(), s.GetRetryCount())
+
+			if s.EmptyBuffer() {
+				return nil
+			}
+
+			msg := fmt.Sprintf("msg lost: in [%d] out [%d] retry [%d] lanes [%d] unacked [%d]", s.GetInCount(),
+				s.GetOutCount(), s.GetRetryCount(), s.lanes.Len(), s.GetUnackedCount())
 			return fmt.Errorf(msg)
-		case buf := <-s.in:
-			_ = s.sendFrame(s.soc, buf, true)
+		case buf := <-s.inChannel():
+			if s.lanes.enabled() {
+				s.lanes.hold(buf)
+			} else {
+				s.publish(buf)
+			}
+		case <-s.lanes.ready:
+			if buf, ok := s.lanes.next(); ok {
+				s.publish(buf)
+			}
+		case buf := <-s.acks.C():
+			s.acks.ack(buf)
+		case <-s.acks.expired():
+			s.redeliver()
+		case <-s.batch.C():
+			s.flush()
 		case r := <-s.retryCh:
 			s.retry(s.soc, r)
+		case <-s.delayed.C():
+			s.retryDue()
 		}
 	}
 }
@@ -358,22 +682,34 @@ func (s *Sock) recovery(f func()) {
 			log.Error().Msgf("recover: %v", r)
 		}
 
-		if s.IsAutoRestart() {
+		if s.IsAutoRestart() && s.ctx.Err() == nil {
+			// socket of the crashed loop is not reused, the new loop creates its own by Attach
+			if s.soc != nil {
+				s.soc.Destroy()
+				s.soc = nil
+			}
+
 			t := timer.AcquireTimer(time.Duration(s.ReconnectIvlMillSec) * time.Millisecond)
+			defer timer.ReleaseTimer(t)
 
-			if !t.Stop() {
-				<-t.C
+			select {
+			case <-t.C:
+			case <-s.ctx.Done():
+				return
 			}
 
 			// recovery the f
 			fPtr := reflect.ValueOf(f).Pointer()
 			log.Warn().Msgf("recover: func %s", runtime.FuncForPC(fPtr).Name())
+
+			if s.onRestart != nil {
+				s.onRestart()
+			}
+
 			Pool.CtxGo(s.ctx, func() {
 				f()
 			})
 
-			timer.ReleaseTimer(t)
-
 			// exit current thread
 			return
 		}
@@ -383,6 +719,48 @@ func (s *Sock) recovery(f func()) {
 	}
 }
 
+// duplex sends msg in 'in' channel and receives msg into 'out' channel in one thread, zeromq socket
+// is not thread safe, so receiving is driven by a poller between sending.
+func (s *Sock) duplex(name string) {
+	_, err := s.Attach()
+	if err != nil {
+		log.Panic().Err(err).Msg("panic on socket Attach")
+		panic(err)
+	}
+
+	poller, err := goczmq.NewPoller(s.soc)
+	if err != nil {
+		log.Panic().Err(err).Msg("panic on create poller")
+		panic(err)
+	}
+
+	defer poller.Destroy()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			if err := s.Release(); err != nil {
+				log.Error().Str("func", name).Msgf("Release err: %s", err.Error())
+			}
+			return
+		case b := <-s.in:
+			_ = s.sendFrame(s.soc, s.wrap(b, xid.NilID()), true)
+		case r := <-s.retryCh:
+			s.retry(s.soc, r)
+		case <-s.delayed.C():
+			s.retryDue()
+		case <-s.dedupe.C():
+			s.put(s.dedupe.expire(time.Now()))
+		case f := <-s.ctl:
+			f(s.soc)
+		default:
+			if poller.Wait(DefaultPollTimeoutMillSec) != nil {
+				_ = s.recvFrame(s.soc)
+			}
+		}
+	}
+}
+
 // Publisher sends msg in 'in' channel. optional sock type: PUB/PUSH
 func (s *Sock) Publisher() {
 	switch s.Type {
@@ -399,17 +777,46 @@ func (s *Sock) Publisher() {
 		panic(err)
 	}
 
+	// PUB replays spool when its first peer connected
+	if s.Type != goczmq.Pub {
+		s.replaySpool()
+	}
+
+	s.acks.start(s.ctx)
+
 	for {
+		// stop reading msg while the in-flight window is full or a msg waits for rate limit
+		in, ready := s.inChannel(), s.lanes.ready
+		if s.acks.full() || s.limiter.held() {
+			in, ready = nil, nil
+		}
+
 		select {
 		case <-s.ctx.Done():
 			if err := s.Release(); err != nil {
 				log.Error().Str("func", "Publisher").Msgf("Release err: %s", err.Error())
 			}
 			return
-		case b := <-s.in:
-			_ = s.sendFrame(s.soc, b, true)
+		case b := <-in:
+			s.take(b)
+		case <-ready:
+			if b, ok := s.lanes.next(); ok && s.throttle(b) {
+				s.publish(b)
+			}
+		case <-s.limiter.C():
+			s.sendHeld()
+		case buf := <-s.acks.C():
+			s.acks.ack(buf)
+		case <-s.acks.expired():
+			s.redeliver()
+		case <-s.batch.C():
+			s.flush()
 		case r := <-s.retryCh:
 			s.retry(s.soc, r)
+		case <-s.delayed.C():
+			s.retryDue()
+		case f := <-s.ctl:
+			f(s.soc)
 		}
 	}
 }
@@ -424,20 +831,8 @@ func (s *Sock) Consumer() {
 
 	defer s.recovery(s.Consumer)
 
-	_, err := s.Attach()
-	if err != nil {
-		log.Panic().Err(err).Msg("panic on socket Attach")
-		panic(err)
-	}
-
-	_ = s.recvFrame(s.soc)
-
-	<-s.ctx.Done()
-
-	err = s.Release()
-	if err != nil {
-		log.Error().Str("func", "Consumer").Msgf("Release err: %s", err.Error())
-	}
+	s.acks.start(s.ctx)
+	s.duplex("Consumer")
 }
 
 // Requester send request msg in 'in' channel and save reply msg in 'out' channel
@@ -469,34 +864,38 @@ func (s *Sock) Requester() {
 			   If the value is -1, it will block until the message is sent.
 			   For all other values, it will try to send the message for that amount of time before returning with an EAGAIN error
 			*/
-			if err := s.sendFrame(s.soc, b, false); err == nil {
-				/* Sets the timeout for receive operation on the socket. If the value is 0, zmq_recv(3)
-				   will return immediately, with a EAGAIN error if there is no message to receive. If the value is -1,
-				   it will block until a message is available. For all other values,
-				   it will wait for a message for that amount of time before returning with an EAGAIN error.
-				*/
-				reply, _, err := s.soc.RecvFrame()
-				if err != nil {
-					log.Error().Err(err).Msgf("requester get no replay at %s", time.Now())
+			if err := s.sendFrame(s.soc, s.wrap(b, xid.NilID()), false); err != nil {
+				// charge empty when an error occurred in sendFrame
+				s.out <- []byte("")
+				continue
+			}
 
-					// charge empty when an error occurred in RecvFrame
-					s.out <- []byte("")
-					return
-				}
+			/* Sets the timeout for receive operation on the socket. If the value is 0, zmq_recv(3)
+			   will return immediately, with a EAGAIN error if there is no message to receive. If the value is -1,
+			   it will block until a message is available. For all other values,
+			   it will wait for a message for that amount of time before returning with an EAGAIN error.
+			*/
+			reply, err := s.recvMsg(s.soc)
+			if err != nil {
+				log.Error().Err(err).Msgf("requester get no replay at %s", time.Now())
 
-				// block when msg in 'out' has not been consumed.
-				s.out <- reply
-				s.recvMsgCount++
+				// charge empty when an error occurred in RecvFrame, REQ socket is relaxed to send the next request
+				s.out <- []byte("")
+				continue
 			}
 
-			// charge empty when an error occurred in sendFrame
-			s.out <- []byte("")
-			s.sendMsgCount++
+			s.recvMsgCount.Add(1)
+
+			// block when msg in 'out' has not been consumed.
+			s.out <- reply
+		case f := <-s.ctl:
+			f(s.soc)
 		}
 	}
 }
 
-// Responser recharge request msg into 'out' channel and get its response msg from 'in' channel
+// Responser recharge request msg into 'out' channel and get its response msg from 'in' channel. when Envelope is
+// enabled, request keeps its Envelope and response is the body only
 func (s *Sock) Responser() {
 	switch s.Type {
 	case goczmq.Rep:
@@ -512,6 +911,15 @@ func (s *Sock) Responser() {
 		panic(err)
 	}
 
+	// request is polled, so control funcs are not delayed by receive timeout
+	poller, err := goczmq.NewPoller(s.soc)
+	if err != nil {
+		log.Panic().Err(err).Msg("panic on create poller")
+		panic(err)
+	}
+
+	defer poller.Destroy()
+
 	for {
 		select {
 		case <-s.ctx.Done():
@@ -519,25 +927,42 @@ func (s *Sock) Responser() {
 				log.Error().Str("func", "Responser").Msgf("Release err: %s", err.Error())
 			}
 			return
+		case f := <-s.ctl:
+			f(s.soc)
 		default:
+			if poller.Wait(DefaultPollTimeoutMillSec) == nil {
+				continue
+			}
+
 			/* Sets the timeout for receive operation on the socket. If the value is 0, zmq_recv(3)
 			   will return immediately, with a EAGAIN error if there is no message to receive. If the value is -1,
 			   it will block until a message is available. For all other values,
 			   it will wait for a message for that amount of time before returning with an EAGAIN error.
 			*/
-			if request, _, err := s.soc.RecvFrame(); err == nil {
+			if request, err := s.recvMsg(s.soc); err == nil {
 				/* Sets the timeout for send operation on the socket.
 				   If the value is 0, zmq_send(3) will return immediately, with a EAGAIN error if the message cannot be sent.
 				   If the value is -1, it will block until the message is sent.
 				   For all other values, it will try to send the message for that amount of time before returning with an EAGAIN error
 				*/
-				s.recvMsgCount++
+				s.recvMsgCount.Add(1)
+
+				// reply carries the ID of request as correlation id
+				correlation := xid.NilID()
+				if e, err := s.unwrap(request); err == nil {
+					correlation = e.ID
+				}
 
 				s.out <- request
-				response := <-s.in
-				if err := s.sendFrame(s.soc, response, false); err == nil {
-					s.sendMsgCount++
+
+				var response []byte
+				select {
+				case response = <-s.in:
+				case <-s.ctx.Done():
+					continue
 				}
+
+				_ = s.sendFrame(s.soc, s.wrap(response, correlation), false)
 			}
 		}
 	}